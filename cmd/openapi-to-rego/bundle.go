@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openapi-to-rego/pkg/opa"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const defaultBundleFileName = "bundle.tar.gz"
+
+func newBundleCommand() *cobra.Command {
+	bundleCmd := &cobra.Command{
+		Use:   "bundle <OpenAPI spec file>",
+		Short: "Generate an OPA bundle with the Rego policy",
+		Run:   runBundle,
+	}
+
+	bundleCmd.Flags().StringVarP(&config.BundleFileName, "output-filename", "o", defaultBundleFileName, "File to output the generated bundle")
+	bundleCmd.Flags().StringVar(&config.RuntimeDir, "runtime-dir", "", "Directory to also output the OPA config.yaml loading the bundle and docker-compose and Kubernetes sidecar snippets")
+	bundleCmd.Flags().StringVar(&config.BundlePath, "bundle-path", opa.DefaultBundlePath, "Local path OPA loads the bundle from")
+	return bundleCmd
+}
+
+func runBundle(cmd *cobra.Command, args []string) {
+	swagger, result := generate(args)
+
+	f, err := os.Create(config.BundleFileName)
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error creating bundle file")
+	}
+	defer f.Close()
+
+	err = opa.WriteBundle(f, result.Files, config.PolicyPackageName, swagger.Info.Version)
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error writing bundle")
+	}
+
+	if config.RuntimeDir != "" {
+		writeRuntimeFiles()
+	}
+}
+
+// writeRuntimeFiles writes the OPA runtime files loading the bundle into the runtime directory
+func writeRuntimeFiles() {
+	bundleFile, err := bundleFileFrom(config.RuntimeDir)
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error locating bundle file")
+	}
+
+	files, err := opa.GenerateRuntimeFiles(mustNewGenerator().Options(), opa.RuntimeConfig{
+		BundlePath: config.BundlePath,
+		BundleFile: bundleFile,
+	})
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error generating OPA runtime files")
+	}
+	err = writeFiles(config.RuntimeDir, files)
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error writing OPA runtime files")
+	}
+}
+
+// bundleFileFrom returns the path of the bundle file relative to the directory
+func bundleFileFrom(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	bundleFile, err := filepath.Abs(config.BundleFileName)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(dir, bundleFile)
+	if err != nil {
+		return "", err
+	}
+	rel = filepath.ToSlash(rel)
+	if !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	return rel, nil
+}
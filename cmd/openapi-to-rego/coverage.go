@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/openapi-to-rego/pkg/opa"
+	"github.com/openapi-to-rego/pkg/util"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	coverageFormatTable = "table"
+	coverageFormatJSON  = "json"
+)
+
+// coverageReport is the machine-readable output of the coverage command
+type coverageReport struct {
+	Operations  []opa.OperationCoverage `json:"operations"`
+	Unprotected int                     `json:"unprotected"`
+}
+
+func newCoverageCommand() *cobra.Command {
+	coverageCmd := &cobra.Command{
+		Use:   "coverage <OpenAPI spec file>",
+		Short: "List the protections the generated policy applies to every operation",
+		Run:   runCoverage,
+	}
+
+	coverageCmd.Flags().StringVarP(&config.CoverageFormat, "format", "f", coverageFormatTable, "Output format of the report, \"table\" or \"json\"")
+	coverageCmd.Flags().BoolVar(&config.FailOnUnprotected, "fail-on-unprotected", false, "Exit with 1 if an operation is public or unconstrained")
+	return coverageCmd
+}
+
+func runCoverage(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		logrus.Fatal("Specify a path to a OpenAPI 3.0 spec file")
+	}
+
+	swagger, err := util.LoadSwagger(args[0])
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error loading OpenAPI spec")
+	}
+
+	coverage, err := opa.Coverage(swagger, mustNewGenerator().Options())
+	if err != nil {
+		fatalErrors(args[0], err, "Error generating Rego")
+	}
+
+	report := coverageReport{Operations: coverage}
+	for _, c := range coverage {
+		if !c.Protected() {
+			report.Unprotected++
+		}
+	}
+
+	switch config.CoverageFormat {
+	case coverageFormatTable:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "OPERATION\tSCOPES\tROLES\tTENANT\tCONDITIONS\tFIELD FILTERS\tLIST FILTERS\tOVERWRITES\tINHERITED\tSTATUS")
+		for _, c := range coverage {
+			fmt.Fprintf(w, "%v %v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", c.Method, c.Path, formatScopes(c.Scopes), orDash(strings.Join(c.Roles, " ")), orDash(c.Tenant), c.Conditions,
+				orDash(strings.Join(c.FieldFilters, ", ")), c.ListFilters, orDash(strings.Join(c.OverwriteFilters, ", ")), formatInherited(c.Inherited), coverageStatus(c))
+		}
+		w.Flush()
+		fmt.Printf("\n%d of %d operations unprotected\n", report.Unprotected, len(coverage))
+	case coverageFormatJSON:
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			logrus.WithField("err", err).Fatal("Error writing JSON")
+		}
+		fmt.Println(string(data))
+	default:
+		logrus.Fatalf("Unknown format %v, use %v or %v", config.CoverageFormat, coverageFormatTable, coverageFormatJSON)
+	}
+
+	if config.FailOnUnprotected && report.Unprotected > 0 {
+		os.Exit(1)
+	}
+}
+
+// coverageStatus flags public and unconstrained operations unless they are denied
+func coverageStatus(c opa.OperationCoverage) string {
+	if c.Denied {
+		return "denied"
+	}
+	flags := []string{}
+	if c.Public {
+		flags = append(flags, "public")
+	}
+	if c.Unconstrained {
+		flags = append(flags, "unconstrained")
+	}
+	if len(flags) == 0 {
+		return "protected"
+	}
+	return "! " + strings.Join(flags, ", ")
+}
+
+// formatScopes formats the scopes per security scheme of the alternative security
+// requirements, eg. "petstore_auth(read:pets) | api_key()". An empty requirement
+// is formatted as "anonymous".
+func formatScopes(requirements []map[string][]string) string {
+	alternatives := make([]string, 0, len(requirements))
+	for _, requirement := range requirements {
+		schemes := make([]string, 0, len(requirement))
+		for scheme, s := range requirement {
+			schemes = append(schemes, fmt.Sprintf("%v(%v)", scheme, strings.Join(s, " ")))
+		}
+		sort.Strings(schemes)
+		if len(schemes) == 0 {
+			schemes = append(schemes, "anonymous")
+		}
+		alternatives = append(alternatives, strings.Join(schemes, ", "))
+	}
+	return orDash(strings.Join(alternatives, " | "))
+}
+
+// formatInherited formats the inherited extensions without their prefix with the levels
+// they are taken from, eg. "roles(tag pets)" or "boolean-filter(path+operation)"
+func formatInherited(inherited map[string][]string) string {
+	extensions := make([]string, 0, len(inherited))
+	for name, levels := range inherited {
+		extensions = append(extensions, fmt.Sprintf("%v(%v)", strings.TrimPrefix(name, "x-security-rego-"), strings.Join(levels, "+")))
+	}
+	sort.Strings(extensions)
+	return orDash(strings.Join(extensions, ", "))
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
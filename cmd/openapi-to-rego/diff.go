@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/openapi-to-rego/pkg/opa"
+	"github.com/openapi-to-rego/pkg/util"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	diffFormatText = "text"
+	diffFormatJSON = "json"
+)
+
+// diffReport is the machine-readable output of the diff command
+type diffReport struct {
+	WidensAccess bool         `json:"widens_access"`
+	Changes      []opa.Change `json:"changes"`
+}
+
+func newDiffCommand() *cobra.Command {
+	diffCmd := &cobra.Command{
+		Use:   "diff <old OpenAPI spec file> <new OpenAPI spec file>",
+		Short: "Compare the authorization of the policies generated from two versions of an OpenAPI spec",
+		Run:   runDiff,
+	}
+
+	diffCmd.Flags().StringVarP(&config.DiffFormat, "format", "f", diffFormatText, "Output format of the changes, \"text\" or \"json\"")
+	diffCmd.Flags().BoolVar(&config.FailOnWidening, "fail-on-widening", false, "Exit with 1 if a change widens access")
+	return diffCmd
+}
+
+func runDiff(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		logrus.Fatal("Specify the paths to the old and the new OpenAPI 3.0 spec file")
+	}
+
+	old, err := util.LoadSwagger(args[0])
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error loading old OpenAPI spec")
+	}
+	new, err := util.LoadSwagger(args[1])
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error loading new OpenAPI spec")
+	}
+
+	changes, err := opa.Diff(old, new, mustNewGenerator().Options())
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error comparing the policies")
+	}
+
+	report := diffReport{Changes: changes}
+	for _, change := range changes {
+		report.WidensAccess = report.WidensAccess || change.WidensAccess
+	}
+
+	switch config.DiffFormat {
+	case diffFormatText:
+		for _, change := range changes {
+			marker := " "
+			if change.WidensAccess {
+				marker = "!"
+			}
+			fmt.Printf("%v %v: %v: %v\n", marker, change.Endpoint, change.Kind, change.Message)
+		}
+		if len(changes) == 0 {
+			fmt.Println("No authorization changes")
+		}
+	case diffFormatJSON:
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			logrus.WithField("err", err).Fatal("Error writing JSON")
+		}
+		fmt.Println(string(data))
+	default:
+		logrus.Fatalf("Unknown format %v, use %v or %v", config.DiffFormat, diffFormatText, diffFormatJSON)
+	}
+
+	if config.FailOnWidening && report.WidensAccess {
+		os.Exit(1)
+	}
+}
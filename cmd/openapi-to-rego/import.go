@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/openapi-to-rego/pkg/opa"
+	"github.com/openapi-to-rego/pkg/util"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newImportCommand() *cobra.Command {
+	importCmd := &cobra.Command{
+		Use:   "import <OpenAPI spec file> <Rego policy file>",
+		Short: "Annotate the OpenAPI spec with the x-security-rego extensions generating an existing Rego policy",
+		Run:   runImport,
+	}
+
+	importCmd.Flags().StringVarP(&config.ImportFileName, "output-filename", "o", "", "File to output the annotated spec, stdout if not set")
+	return importCmd
+}
+
+func runImport(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		logrus.Fatal("Specify the paths to a OpenAPI 3.0 spec file and a Rego policy file")
+	}
+	specFile, policyFile := args[0], args[1]
+
+	swagger, err := util.LoadSwagger(specFile)
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error loading OpenAPI spec")
+	}
+	policy, err := ioutil.ReadFile(policyFile)
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error reading Rego policy")
+	}
+
+	result, err := opa.Import(swagger, string(policy), mustNewGenerator().Options())
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error parsing Rego policy")
+	}
+
+	spec, err := ioutil.ReadFile(specFile)
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error reading OpenAPI spec")
+	}
+	for _, annotation := range result.Annotations {
+		spec, err = util.AddExtension(specFile, spec, annotation.Pointer, annotation.Extension, annotation.Value)
+		if err != nil {
+			logrus.WithField("err", err).Fatalf("Error annotating %v %v", annotation.Method, annotation.Path)
+		}
+	}
+
+	for _, problem := range result.Problems {
+		if problem.Line == 0 {
+			logrus.Warnf("%v: %v", policyFile, problem.Message)
+			continue
+		}
+		logrus.WithField("rule", problem.Rule).Warnf("%v:%v: %v", policyFile, problem.Line, problem.Message)
+	}
+
+	if config.ImportFileName == "" {
+		fmt.Print(string(spec))
+		return
+	}
+	err = ioutil.WriteFile(config.ImportFileName, spec, 0644)
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error writing OpenAPI spec")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/openapi-to-rego/pkg/opa"
+	"github.com/openapi-to-rego/pkg/util"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	lintFormatText  = "text"
+	lintFormatSARIF = "sarif"
+)
+
+func newLintCommand() *cobra.Command {
+	lintCmd := &cobra.Command{
+		Use:   "lint <OpenAPI spec file>",
+		Short: "Check the x-security-rego extensions of the OpenAPI spec",
+		Run:   runLint,
+	}
+
+	lintCmd.Flags().StringVarP(&config.LintFormat, "format", "f", lintFormatText, "Output format of the problems, \"text\" or \"sarif\"")
+	return lintCmd
+}
+
+func runLint(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		logrus.Fatal("Specify a path to a OpenAPI 3.0 spec file")
+	}
+
+	swagger, err := util.LoadSwagger(args[0])
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error loading OpenAPI spec")
+	}
+
+	locator, err := util.NewLocator(args[0])
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error reading OpenAPI spec")
+	}
+
+	problems := opa.Lint(swagger)
+	for i := range problems {
+		problems[i].Line = locator.Line(problems[i].Pointer)
+	}
+
+	switch config.LintFormat {
+	case lintFormatText:
+		for _, problem := range problems {
+			fmt.Printf("%v:%v: %v: %v: %v\n", args[0], problem.Line, problem.Pointer, problem.Severity, problem.Message)
+		}
+	case lintFormatSARIF:
+		err = opa.WriteSARIF(os.Stdout, args[0], problems)
+		if err != nil {
+			logrus.WithField("err", err).Fatal("Error writing SARIF")
+		}
+	default:
+		logrus.Fatalf("Unknown format %v, use %v or %v", config.LintFormat, lintFormatText, lintFormatSARIF)
+	}
+
+	for _, problem := range problems {
+		if problem.Severity == opa.SeverityError {
+			os.Exit(1)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/openapi-to-rego/pkg/opa"
 	"github.com/openapi-to-rego/pkg/util"
 	"github.com/sirupsen/logrus"
@@ -15,6 +18,28 @@ import (
 type Config struct {
 	PolicyPackageName string
 	OutputFileName    string
+	Decision          bool
+	SplitBy           string
+	OutputDir         string
+	BundleFileName    string
+	Mode              string
+	RegoVersion       string
+	RuntimeDir        string
+	BundlePath        string
+	LintFormat        string
+	Input             string
+	Target            string
+	Strategy          string
+	RolesClaim        string
+	Resources         string
+	ResourceSchema    string
+	DataFile          string
+	Watch             bool
+	DiffFormat        string
+	FailOnWidening    bool
+	ImportFileName    string
+	CoverageFormat    string
+	FailOnUnprotected bool
 }
 
 var (
@@ -23,19 +48,42 @@ var (
 )
 
 const (
-	defaultPolicyPackageName = "httpapi.authz"
+	defaultPolicyPackageName = opa.DefaultPackageName
 	defaultOutputFileName    = "policy.rego"
+	defaultOutputDir         = "policy"
+	defaultResourceSchema    = "resources.schema.json"
 )
 
 func init() {
 	cmd = &cobra.Command{
 		Use:   path.Base(os.Args[0]) + " <OpenAPI spec file> ",
 		Short: "OpenAPI to Rego Converter",
+		Args:  cobra.ArbitraryArgs,
 		Run:   run,
 	}
 
-	cmd.Flags().StringVarP(&config.PolicyPackageName, "package-name", "p", defaultPolicyPackageName, "Rego policy package name")
+	cmd.PersistentFlags().StringVarP(&config.PolicyPackageName, "package-name", "p", defaultPolicyPackageName, "Rego policy package name")
+	cmd.PersistentFlags().BoolVarP(&config.Decision, "decision", "d", false, "Generate a decision object with reasons and matched rule IDs")
+	cmd.PersistentFlags().StringVarP(&config.SplitBy, "split-by", "s", "", "Split the policy into a package per \"tag\" or \"path\" prefix and a router package")
+	cmd.PersistentFlags().StringVarP(&config.Mode, "mode", "m", opa.ModeRules, "Generate Rego \"rules\" for every operation or \"data\" tables evaluated by a generic policy")
+	cmd.PersistentFlags().StringVar(&config.RegoVersion, "rego-version", opa.RegoV1, "Syntax of the generated Rego, \"v1\" for OPA 1.0 or \"v0\" for older versions")
+	cmd.PersistentFlags().StringVar(&config.Input, "input", opa.PresetDefault, "Input document the policy reads, a preset (\"default\", \"http\" or \"envoy\") or a JSON or YAML input mapping file")
+	cmd.PersistentFlags().StringVar(&config.Target, "target", opa.TargetOPA, "Integration the policy is generated for, \"opa\" or \"envoy\" for the Envoy ext_authz filter")
+	cmd.PersistentFlags().StringVar(&config.Strategy, "strategy", opa.StrategyAllow, "How operations without a boolean filter are allowed, \"allow\", \"authenticated\" if the request has a token or \"deny\"")
+	cmd.PersistentFlags().StringVar(&config.DataFile, "data", "", "JSON or YAML permissions file mapping roles to the operationIds, tags and scopes they are allowed, generated as data.json")
+	cmd.PersistentFlags().StringVar(&config.RolesClaim, "roles-claim", opa.DefaultRolesClaim, "Claim of the token payload holding the roles of the user, eg. \"realm_access.roles\"")
+	cmd.PersistentFlags().StringVar(&config.Resources, "resources", opa.DefaultResources, "Document below data holding the resource data read by the data operands, eg. \"inventory.resources\"")
 	cmd.Flags().StringVarP(&config.OutputFileName, "output-filename", "o", defaultOutputFileName, "File to output generated Rego code")
+	cmd.Flags().BoolVarP(&config.Watch, "watch", "w", false, "Regenerate the Rego files whenever the spec or a file it references changes")
+	cmd.Flags().StringVar(&config.OutputDir, "output-dir", defaultOutputDir, "Directory to output generated files when splitting the policy or generating data")
+	cmd.Flags().StringVar(&config.ResourceSchema, "resource-schema", defaultResourceSchema, "File to output the JSON Schema of the resource data the policy reads, if it reads any")
+
+	cmd.AddCommand(newBundleCommand())
+	cmd.AddCommand(newCoverageCommand())
+	cmd.AddCommand(newDiffCommand())
+	cmd.AddCommand(newImportCommand())
+	cmd.AddCommand(newLintCommand())
+	cmd.AddCommand(newSchemaCommand())
 }
 
 func main() {
@@ -43,25 +91,186 @@ func main() {
 }
 
 func run(cmd *cobra.Command, args []string) {
+	if config.Watch && len(args) > 0 {
+		watch(args[0])
+		return
+	}
+
+	_, result := generate(args)
+	err := writeOutput(result)
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error writing output")
+	}
+}
+
+// writeOutput writes a single generated file to the output file and several files
+// into the output directory, and the schema of the resource data the policy reads.
+// Several files cannot be written to an output file given with the flag.
+func writeOutput(result *opa.Result) error {
+	files := result.Files
+	if len(files) > 1 && cmd.Flags().Changed("output-filename") {
+		return fmt.Errorf("%v files are generated and cannot be written to %v, use --output-dir to write them into a directory", len(files), config.OutputFileName)
+	}
+
+	if result.ResourceSchema != nil {
+		err := ioutil.WriteFile(config.ResourceSchema, result.ResourceSchema, 0644)
+		if err != nil {
+			return fmt.Errorf("error writing resource schema to file: %v", err)
+		}
+	}
+
+	if len(files) == 1 {
+		err := ioutil.WriteFile(config.OutputFileName, []byte(files[0].Content), 0644)
+		if err != nil {
+			return fmt.Errorf("error writing Rego to file: %v", err)
+		}
+		return nil
+	}
+
+	return writeFiles(config.OutputDir, files)
+}
+
+// writeFiles writes the generated files into the directory
+func writeFiles(dir string, files []opa.File) error {
+	for _, file := range files {
+		fileName := filepath.Join(dir, filepath.FromSlash(file.Name))
+		err := os.MkdirAll(filepath.Dir(fileName), 0755)
+		if err != nil {
+			return fmt.Errorf("error creating output directory: %v", err)
+		}
 
-	if len(os.Args) < 2 {
+		err = ioutil.WriteFile(fileName, []byte(file.Content), 0644)
+		if err != nil {
+			return fmt.Errorf("error writing file: %v", err)
+		}
+	}
+	return nil
+}
+
+// generate loads the OpenAPI spec given in the arguments and generates the Rego files
+func generate(args []string) (*openapi3.Swagger, *opa.Result) {
+
+	if len(args) < 1 {
 		logrus.Fatal("Specify a path to a OpenAPI 3.0 spec file")
 	}
 
 	// load OpenAPI spec
-	swagger, err := util.LoadSwagger(os.Args[1])
+	swagger, err := util.LoadSwagger(args[0])
 	if err != nil {
 		logrus.WithField("err", err).Fatal("Error loading OpenAPI spec")
 	}
 
 	// generate Rego
-	rego, err := opa.Generate(swagger, config.PolicyPackageName)
+	generator := mustNewGenerator()
+	if n := validatePermissions(swagger, generator); n > 0 {
+		logrus.Fatalf("Error loading permissions: %d error(s) found", n)
+	}
+
+	result, err := generator.Generate(swagger)
 	if err != nil {
-		logrus.WithField("err", err).Fatal("Error generating Rego")
+		fatalErrors(args[0], err, "Error generating Rego")
 	}
+	return swagger, result
+}
 
-	err = ioutil.WriteFile(config.OutputFileName, []byte(rego), 0644)
+// mustNewGenerator returns a generator configured by the flags and exits if the files
+// they reference cannot be loaded
+func mustNewGenerator() *opa.Generator {
+	generator, err := newGenerator()
 	if err != nil {
-		logrus.WithField("err", err).Fatal("Error writing Rego to file")
+		logrus.WithField("err", err).Fatal("Error configuring generator")
+	}
+	return generator
+}
+
+// newGenerator returns a generator configured by the flags
+func newGenerator() (*opa.Generator, error) {
+	options := []opa.Option{
+		opa.WithPackageName(config.PolicyPackageName),
+		opa.WithTarget(config.Target),
+		opa.WithStrategy(config.Strategy),
+		opa.WithRolesClaim(config.RolesClaim),
+		opa.WithResources(config.Resources),
+		opa.WithDecision(config.Decision),
+		opa.WithLayout(config.SplitBy),
+		opa.WithMode(config.Mode),
+		opa.WithRegoVersion(config.RegoVersion),
+	}
+
+	// the target defines the input unless it is given explicitly
+	if config.Target != opa.TargetEnvoy || cmd.PersistentFlags().Lookup("input").Changed {
+		mapping, err := inputMapping()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, opa.WithInputMapping(mapping))
+	}
+
+	if config.DataFile != "" {
+		var permissions opa.Permissions
+		err := util.LoadConfig(config.DataFile, &permissions)
+		if err != nil {
+			return nil, fmt.Errorf("error loading permissions: %v", err)
+		}
+		options = append(options, opa.WithPermissions(&permissions))
+	}
+
+	return opa.NewGenerator(options...), nil
+}
+
+// validatePermissions logs the errors of the permissions file of the generator, if
+// any, with their location and returns their number
+func validatePermissions(swagger *openapi3.Swagger, generator *opa.Generator) int {
+	permissions := generator.Options().Permissions
+	if permissions == nil {
+		return 0
+	}
+
+	err := opa.ValidatePermissions(swagger, permissions)
+	if errs, ok := err.(opa.Errors); ok {
+		logErrors(config.DataFile, errs, "Invalid permissions")
+		return len(errs)
+	}
+	return 0
+}
+
+// inputMapping returns the input preset or loads the input mapping file given in the config
+func inputMapping() (opa.InputMapping, error) {
+	if mapping, ok := opa.InputPresets[config.Input]; ok {
+		return mapping, nil
+	}
+
+	var mapping opa.InputMapping
+	err := util.LoadConfig(config.Input, &mapping)
+	if err != nil {
+		return mapping, fmt.Errorf("error loading input mapping: %v", err)
+	}
+	return mapping, nil
+}
+
+// fatalErrors logs the errors found in the OpenAPI spec file with their location and exits.
+// Other errors are logged as is.
+func fatalErrors(filePath string, err error, message string) {
+	errs, ok := err.(opa.Errors)
+	if !ok {
+		logrus.WithField("err", err).Fatal(message)
+	}
+
+	logErrors(filePath, errs, "Invalid OpenAPI spec")
+	logrus.Fatalf("%v: %d error(s) found", message, len(errs))
+}
+
+// logErrors logs the errors found in the OpenAPI spec file, or another file such as
+// the permissions, with their location
+func logErrors(filePath string, errs opa.Errors, message string) {
+	locator, err := util.NewLocator(filePath)
+	if err != nil {
+		logrus.WithField("err", err).Errorf("Error reading %v", filePath)
+	} else {
+		errs.Locate(filePath, locator.Line)
+	}
+
+	for _, e := range errs {
+		logrus.WithField("err", e).Error(message)
 	}
 }
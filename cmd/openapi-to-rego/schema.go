@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/openapi-to-rego/pkg/opa"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newSchemaCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of the x-security-rego extensions",
+		Args:  cobra.NoArgs,
+		Run:   runSchema,
+	}
+}
+
+func runSchema(cmd *cobra.Command, args []string) {
+	schema, err := opa.Schema()
+	if err != nil {
+		logrus.WithField("err", err).Fatal("Error generating JSON Schema")
+	}
+	fmt.Println(string(schema))
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openapi-to-rego/pkg/opa"
+	"github.com/openapi-to-rego/pkg/util"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// watchInterval is the time between polling the watched files
+	watchInterval = 500 * time.Millisecond
+
+	// watchDebounce is the time the watched files must stay unchanged before regenerating
+	watchDebounce = time.Second
+)
+
+// watch generates the Rego files and regenerates them whenever the spec or a file
+// it references changes. Errors are reported without exiting, the output keeps
+// the last valid policy.
+func watch(specFile string) {
+	watched := watchedFiles(specFile)
+	last, _ := regenerate(specFile)
+
+	watcher := &util.Watcher{Interval: watchInterval, Debounce: watchDebounce}
+	logrus.WithField("files", strings.Join(watched, ", ")).Info("Watching for changes")
+
+	watcher.Watch(func() []string { return watched }, func() {
+		watched = watchedFiles(specFile)
+
+		files, ok := regenerate(specFile)
+		if !ok {
+			return
+		}
+		printRuleDiff(last, files)
+		last = files
+	}, nil)
+}
+
+// watchedFiles returns the spec and the files it references
+func watchedFiles(specFile string) []string {
+	refFiles, err := util.RefFiles(specFile)
+	if err != nil {
+		logrus.WithField("err", err).Warn("Error finding the files referenced by the OpenAPI spec")
+	}
+	files := append([]string{specFile}, refFiles...)
+	if config.DataFile != "" {
+		files = append(files, config.DataFile)
+	}
+	return files
+}
+
+// regenerate generates and writes the Rego files. The errors are logged and no
+// files are written if the spec or the files configuring the generator are invalid.
+func regenerate(specFile string) ([]opa.File, bool) {
+	swagger, err := util.LoadSwagger(specFile)
+	if err != nil {
+		logrus.WithField("err", err).Error("Error loading OpenAPI spec")
+		return nil, false
+	}
+
+	generator, err := newGenerator()
+	if err != nil {
+		logrus.WithField("err", err).Error("Error configuring generator, keeping the last generated policy")
+		return nil, false
+	}
+	if n := validatePermissions(swagger, generator); n > 0 {
+		logrus.Errorf("Error loading permissions: %d error(s) found, keeping the last generated policy", n)
+		return nil, false
+	}
+
+	result, err := generator.Generate(swagger)
+	if errs, ok := err.(opa.Errors); ok {
+		logErrors(specFile, errs, "Invalid OpenAPI spec")
+		logrus.Errorf("Error generating Rego: %d error(s) found, keeping the last generated policy", len(errs))
+		return nil, false
+	} else if err != nil {
+		logrus.WithField("err", err).Error("Error generating Rego")
+		return nil, false
+	}
+
+	err = writeOutput(result)
+	if err != nil {
+		logrus.WithField("err", err).Error("Error writing output")
+		return nil, false
+	}
+	logrus.WithField("files", len(result.Files)).Info("Generated Rego")
+	return result.Files, true
+}
+
+// printRuleDiff prints the rules removed and added between the generated files.
+// Rules are printed on a single line.
+func printRuleDiff(old []opa.File, new []opa.File) {
+	oldRules, newRules := fileRules(old), fileRules(new)
+
+	changed := false
+	for _, name := range fileNames(old, new) {
+		removed := missingRules(oldRules[name], newRules[name])
+		added := missingRules(newRules[name], oldRules[name])
+		if len(removed) == 0 && len(added) == 0 {
+			continue
+		}
+
+		changed = true
+		fmt.Printf("%v:\n", name)
+		for _, rule := range removed {
+			fmt.Printf("- %v\n", rule)
+		}
+		for _, rule := range added {
+			fmt.Printf("+ %v\n", rule)
+		}
+	}
+	if !changed {
+		fmt.Println("No rules changed")
+	}
+}
+
+// fileRules returns the rules of each file, ie. its blocks separated by empty lines,
+// with each block on a single line
+func fileRules(files []opa.File) map[string][]string {
+	rules := map[string][]string{}
+	for _, file := range files {
+		for _, block := range strings.Split(file.Content, "\n\n") {
+			rule := ""
+			for _, line := range strings.Split(block, "\n") {
+				line = strings.TrimSpace(line)
+				switch {
+				case line == "":
+				case rule == "":
+					rule = line
+				case strings.HasSuffix(rule, "{") || strings.HasSuffix(rule, "[") || strings.HasSuffix(rule, ",") || strings.HasPrefix(line, "}") || strings.HasPrefix(line, "]"):
+					rule += " " + line
+				default:
+					// expressions of a body
+					rule += "; " + line
+				}
+			}
+			if rule != "" {
+				rules[file.Name] = append(rules[file.Name], rule)
+			}
+		}
+	}
+	return rules
+}
+
+// missingRules returns the rules missing from the other rules, keeping their order
+func missingRules(rules []string, other []string) []string {
+	counts := map[string]int{}
+	for _, rule := range other {
+		counts[rule]++
+	}
+
+	missing := []string{}
+	for _, rule := range rules {
+		if counts[rule] > 0 {
+			counts[rule]--
+			continue
+		}
+		missing = append(missing, rule)
+	}
+	return missing
+}
+
+// fileNames returns the names of the old and new files in order
+func fileNames(old []opa.File, new []opa.File) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, files := range [][]opa.File{old, new} {
+		for _, file := range files {
+			if !seen[file.Name] {
+				seen[file.Name] = true
+				names = append(names, file.Name)
+			}
+		}
+	}
+	return names
+}
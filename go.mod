@@ -4,6 +4,7 @@ go 1.12
 
 require (
 	github.com/getkin/kin-openapi v0.2.0
+	github.com/ghodss/yaml v1.0.0
 	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/cobra v0.0.5
 )
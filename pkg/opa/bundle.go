@@ -0,0 +1,94 @@
+package opa
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	// bundleManifestFileName is the name of the OPA bundle manifest
+	bundleManifestFileName = ".manifest"
+
+	// bundleHashLength is the number of hex characters of the content hash used in the revision
+	bundleHashLength = 12
+)
+
+// bundleManifest defines the manifest of an OPA bundle
+type bundleManifest struct {
+	Revision string   `json:"revision"`
+	Roots    []string `json:"roots"`
+}
+
+// WriteBundle writes the generated files as an OPA bundle, ie. a gzipped tarball
+// with a manifest, to w. The only bundle root is derived from the package name.
+// The bundle revision is the spec version followed by a hash of the files content.
+func WriteBundle(w io.Writer, files []File, packageName string, version string) error {
+	root := strings.Replace(packageName, ".", "/", -1)
+
+	sorted := make([]File, len(files))
+	copy(sorted, files)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	manifest := bundleManifest{
+		Revision: fmt.Sprintf("%v-%v", version, contentHash(sorted)),
+		Roots:    []string{root},
+	}
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	err = writeTarFile(tw, "/"+bundleManifestFileName, manifestData)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range sorted {
+		err = writeTarFile(tw, "/"+file.Name, []byte(file.Content))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// contentHash returns a hash of the names and content of the files
+func contentHash(files []File) string {
+	h := sha256.New()
+	for _, file := range files {
+		fmt.Fprintf(h, "%v\x00%v\x00", file.Name, file.Content)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:bundleHashLength]
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Typeflag: tar.TypeReg,
+		Size:     int64(len(data)),
+	}
+
+	err := tw.WriteHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(data)
+	return err
+}
@@ -0,0 +1,76 @@
+package opa
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteBundle(t *testing.T) {
+	swagger := loadTestSpec(t, testPetstore)
+
+	for _, options := range []Options{
+		{Layout: LayoutTag, Decision: true},
+		{Mode: ModeData},
+	} {
+		options.PackageName = "example.authz"
+		files, err := GenerateFiles(swagger, options)
+		if err != nil {
+			t.Fatalf("%+v: %v", options, err)
+		}
+
+		var buf bytes.Buffer
+		err = WriteBundle(&buf, files, options.PackageName, swagger.Info.Version)
+		if err != nil {
+			t.Fatalf("%+v: WriteBundle: %v", options, err)
+		}
+
+		gr, err := gzip.NewReader(&buf)
+		if err != nil {
+			t.Fatalf("%+v: %v", options, err)
+		}
+		tr := tar.NewReader(gr)
+		var manifest bundleManifest
+		bundled := []File{}
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%+v: %v", options, err)
+			}
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("%+v: %v", options, err)
+			}
+			if header.Name == "/"+bundleManifestFileName {
+				err = json.Unmarshal(data, &manifest)
+				if err != nil {
+					t.Fatalf("%+v: manifest: %v", options, err)
+				}
+				continue
+			}
+			bundled = append(bundled, File{Name: strings.TrimPrefix(header.Name, "/"), Content: string(data)})
+		}
+
+		if !reflect.DeepEqual(manifest.Roots, []string{"example/authz"}) {
+			t.Errorf("%+v: roots %v, want [example/authz]", options, manifest.Roots)
+		}
+		if !strings.HasPrefix(manifest.Revision, "1.0.0-") || len(manifest.Revision) != len("1.0.0-")+bundleHashLength {
+			t.Errorf("%+v: revision %v, want the version and the content hash", options, manifest.Revision)
+		}
+		if len(bundled) != len(files) {
+			t.Errorf("%+v: bundled %v files, want %v", options, len(bundled), len(files))
+		}
+		if modules := checkRegoFiles(t, bundled); len(modules) == 0 {
+			t.Errorf("%+v: the bundle holds no policy", options)
+		}
+	}
+}
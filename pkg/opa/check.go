@@ -0,0 +1,70 @@
+package opa
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/openapi-to-rego/pkg/rego"
+)
+
+// source defines a fragment of the generated Rego copied from the OpenAPI spec
+// and the location in the spec it originates from
+type source struct {
+	Text    string
+	Pointer string
+}
+
+// checkFiles parses and checks the generated Rego files. The errors found are
+// reported with the generated line and located by the spec location it originates from.
+func checkFiles(files []File, sources []source) error {
+	var errs Errors
+
+	for _, file := range files {
+		if filepath.Ext(file.Name) != ".rego" {
+			continue
+		}
+
+		var regoErrs []*rego.Error
+		module, err := rego.Parse(file.Content)
+		if err != nil {
+			parseErr, ok := err.(*rego.Error)
+			if !ok {
+				return err
+			}
+			regoErrs = []*rego.Error{parseErr}
+		} else {
+			regoErrs = rego.Check(module)
+		}
+
+		lines := strings.Split(file.Content, "\n")
+		for _, e := range regoErrs {
+			generated := &Error{Message: fmt.Sprintf("generated Rego is invalid: %v:%v", file.Name, e)}
+			if e.Line > 0 && e.Line <= len(lines) {
+				line := strings.TrimSpace(lines[e.Line-1])
+				generated.Message += fmt.Sprintf(" in %q", line)
+				generated.Pointer = sourcePointer(line, e.Message, sources)
+			}
+			errs = append(errs, generated)
+		}
+	}
+	return errs.err()
+}
+
+// sourcePointer returns the spec location of the source contained in the line.
+// Sources which are also mentioned by the error message are preferred, then the
+// longest one.
+func sourcePointer(line string, message string, sources []source) string {
+	var match source
+	var mentioned bool
+	for _, s := range sources {
+		if s.Text == "" || !strings.Contains(line, s.Text) {
+			continue
+		}
+		m := strings.Contains(message, s.Text)
+		if m && !mentioned || m == mentioned && len(s.Text) > len(match.Text) {
+			match, mentioned = s, m
+		}
+	}
+	return match.Pointer
+}
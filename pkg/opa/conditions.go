@@ -0,0 +1,196 @@
+package opa
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const (
+	// OAS Extension of the components defining named conditions, which the
+	// operations of the other extensions reference
+	oasSecExtRegoConditions = "x-security-rego-conditions"
+
+	// refOp references a named condition by a JSON pointer into the components
+	refOp = "$ref"
+
+	// conditionOp references a named condition by its name
+	conditionOp = "condition"
+
+	// conditionRefPrefix is the prefix of the pointers to the named conditions
+	conditionRefPrefix = "#/components/" + oasSecExtRegoConditions + "/"
+)
+
+var (
+	// conditionNameRE matches the names of the conditions, which are part of the
+	// names of the helper rules
+	conditionNameRE = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
+	// conditionRulePrefixes are the prefixes of the helper rules of the named
+	// conditions per extension, as the operands are compiled per extension
+	conditionRulePrefixes = map[string]string{
+		oasSecExtRegoBooleanFilter:   "condition_",
+		oasSecExtRegoListFilter:      "list_condition_",
+		oasSecExtRegoOverwriteFilter: "overwrite_condition_",
+	}
+)
+
+// namedConditions maps the name of a condition to the operations of which all
+// need to be satisfied
+type namedConditions map[string][]operation
+
+// loadConditions reads the named conditions of the components, if any. The
+// conditions are nil if the extension cannot be decoded.
+func loadConditions(swagger *openapi3.Swagger) (namedConditions, Errors) {
+	var errs Errors
+	conditions := namedConditions{}
+	val, ok := swagger.Components.Extensions[oasSecExtRegoConditions]
+	if !ok {
+		return conditions, nil
+	}
+
+	err := unmarshalExtension(val, &conditions)
+	if err != nil {
+		errs.add([]interface{}{"components", oasSecExtRegoConditions}, "%v", err)
+		return nil, errs
+	}
+	for _, name := range sortedKeys(conditions) {
+		if !conditionNameRE.MatchString(name) {
+			errs.add(conditionPointer(name), "illegal condition name %v, use letters, digits and underscores", name)
+		}
+		for k, operation := range conditions[name] {
+			for _, op := range sortedKeys(operation) {
+				if isReference(op) {
+					errs.add(conditionPointer(name, k, op), "condition %v references another condition", name)
+				}
+			}
+		}
+	}
+	return conditions, errs
+}
+
+// conditionPointer returns the pointer to a named condition in the spec
+func conditionPointer(name string, tokens ...interface{}) []interface{} {
+	return pointerAt([]interface{}{"components", oasSecExtRegoConditions, name}, tokens...)
+}
+
+// isReference returns whether the operator references a named condition
+func isReference(op string) bool {
+	return op == refOp || op == conditionOp
+}
+
+// reference returns the name of the condition referenced by the operands of a
+// reference operator, or an error if the spec does not define it
+func (c namedConditions) reference(op string, operands []interface{}) (string, error) {
+	var name string
+	if len(operands) == 1 {
+		name, _ = operands[0].(string)
+	}
+	if op == refOp {
+		if !strings.HasPrefix(name, conditionRefPrefix) {
+			return "", fmt.Errorf("%v %v does not point to a condition of the components", refOp, name)
+		}
+		name = strings.TrimPrefix(name, conditionRefPrefix)
+	}
+
+	if _, ok := c[name]; !ok {
+		return "", fmt.Errorf("unknown condition %v", name)
+	}
+	return name, nil
+}
+
+// params returns the path parameters the operations of the condition reference, sorted
+func (c namedConditions) params(name string) []string {
+	params := map[string]bool{}
+	for _, operation := range c[name] {
+		for _, operands := range operation {
+			for _, operand := range operands {
+				for _, param := range operandParams(operand) {
+					params[param] = true
+				}
+			}
+		}
+	}
+	return sortedKeys(params)
+}
+
+// conditionHelper is the helper rule generated for a named condition referenced by
+// an extension. Call is both the head of the rule and the expression calling it, the
+// arguments are the list item of list filters and the path parameters.
+type conditionHelper struct {
+	Call        string
+	Args        []string
+	Expressions []string
+	Groups      map[string]bool
+}
+
+// conditionHelpers returns the helper rules sorted by their call
+func conditionHelpers(helpers map[string]*conditionHelper) []conditionHelper {
+	result := []conditionHelper{}
+	for _, call := range sortedKeys(helpers) {
+		result = append(result, *helpers[call])
+	}
+	return result
+}
+
+// expandConditions returns the expressions with the calls of the helper rules replaced
+// by their expressions, so that the expressions of the conditions are compared
+func expandConditions(expressions []string, helpers []conditionHelper) []string {
+	calls := map[string][]string{}
+	for _, helper := range helpers {
+		calls[helper.Call] = helper.Expressions
+	}
+
+	result := []string{}
+	for _, expression := range expressions {
+		if helper, ok := calls[expression]; ok {
+			result = append(result, helper...)
+		} else {
+			result = append(result, expression)
+		}
+	}
+	return result
+}
+
+// UnmarshalJSON decodes an operation. The operand of a reference to a named
+// condition is a string rather than a list.
+func (o *operation) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	*o = operation{}
+	for op, value := range raw {
+		var operands []interface{}
+		if isReference(op) {
+			var name string
+			err = json.Unmarshal(value, &name)
+			operands = []interface{}{name}
+		} else {
+			err = json.Unmarshal(value, &operands)
+		}
+		if err != nil {
+			return err
+		}
+		(*o)[op] = operands
+	}
+	return nil
+}
+
+// MarshalJSON encodes an operation like it is decoded
+func (o operation) MarshalJSON() ([]byte, error) {
+	raw := map[string]interface{}{}
+	for op, operands := range o {
+		if isReference(op) && len(operands) == 1 {
+			raw[op] = operands[0]
+		} else {
+			raw[op] = []interface{}(operands)
+		}
+	}
+	return json.Marshal(raw)
+}
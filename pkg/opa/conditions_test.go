@@ -0,0 +1,184 @@
+package opa
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpressionCompilerCall(t *testing.T) {
+	conditions := namedConditions{
+		"adult":    {{"gte": {"age", int64(18)}}},
+		"owns_pet": {{"eq": {"$petId", "token.payload.pets[_].petId"}}},
+	}
+
+	tests := []struct {
+		op          string
+		name        string
+		extension   string
+		call        string
+		args        []string
+		expressions []string
+	}{
+		{
+			op: conditionOp, name: "adult", extension: oasSecExtRegoBooleanFilter,
+			call: "condition_adult", args: []string{}, expressions: []string{"age >= 18"},
+		},
+		{
+			op: refOp, name: conditionRefPrefix + "adult", extension: oasSecExtRegoBooleanFilter,
+			call: "condition_adult", args: []string{}, expressions: []string{"age >= 18"},
+		},
+		{
+			op: conditionOp, name: "adult", extension: oasSecExtRegoListFilter,
+			call: "list_condition_adult(x)", args: []string{"x"}, expressions: []string{"x.age >= 18"},
+		},
+		{
+			op: conditionOp, name: "adult", extension: oasSecExtRegoOverwriteFilter,
+			call: "overwrite_condition_adult", args: []string{}, expressions: []string{"input.object.age >= 18"},
+		},
+		{
+			op: conditionOp, name: "owns_pet", extension: oasSecExtRegoBooleanFilter,
+			call: "condition_owns_pet(petId)", args: []string{"petId"}, expressions: []string{"petId = token.payload.pets[_].petId"},
+		},
+		{
+			op: conditionOp, name: "owns_pet", extension: oasSecExtRegoListFilter,
+			call: "list_condition_owns_pet(x, petId)", args: []string{"x", "petId"}, expressions: []string{"petId = token.payload.pets[_].petId"},
+		},
+	}
+
+	for _, test := range tests {
+		var errs Errors
+		c := &expressionCompiler{
+			input:      defaultInputFields,
+			resources:  DefaultResources,
+			conditions: conditions,
+			helpers:    map[string]*conditionHelper{},
+			sources:    &[]source{},
+			errs:       &errs,
+		}
+
+		call, err := c.call(test.op, []interface{}{test.name}, test.extension, "pets")
+		if err != nil || len(errs) > 0 {
+			t.Errorf("%v %v in %v: %v %v", test.op, test.name, test.extension, err, errs)
+			continue
+		}
+		if call != test.call {
+			t.Errorf("%v %v in %v: call %v, want %v", test.op, test.name, test.extension, call, test.call)
+		}
+		helper := c.helpers[call]
+		if helper == nil {
+			t.Errorf("%v %v in %v: no helper for %v", test.op, test.name, test.extension, call)
+			continue
+		}
+		if !reflect.DeepEqual(helper.Args, test.args) || !reflect.DeepEqual(helper.Expressions, test.expressions) {
+			t.Errorf("%v %v in %v: helper %+v, want the args %v and the expressions %v", test.op, test.name, test.extension, helper, test.args, test.expressions)
+		}
+	}
+}
+
+func TestExpressionCompilerCallReuse(t *testing.T) {
+	var errs Errors
+	c := &expressionCompiler{
+		input:      defaultInputFields,
+		resources:  DefaultResources,
+		conditions: namedConditions{"adult": {{"gte": {"age", int64(18)}}}},
+		helpers:    map[string]*conditionHelper{},
+		sources:    &[]source{},
+		errs:       &errs,
+	}
+
+	// the helper is compiled once per extension and records every group calling it
+	calls := []struct {
+		extension string
+		group     string
+	}{
+		{oasSecExtRegoBooleanFilter, "pets"},
+		{oasSecExtRegoBooleanFilter, "store"},
+		{oasSecExtRegoListFilter, "pets"},
+		{oasSecExtRegoBooleanFilter, "pets"},
+	}
+	for _, call := range calls {
+		if _, err := c.call(conditionOp, []interface{}{"adult"}, call.extension, call.group); err != nil {
+			t.Fatalf("call in %v: %v", call.extension, err)
+		}
+	}
+
+	if got := sortedKeys(c.helpers); !reflect.DeepEqual(got, []string{"condition_adult", "list_condition_adult(x)"}) {
+		t.Errorf("helpers %v, want condition_adult and list_condition_adult(x)", got)
+	}
+	if got := sortedKeys(c.helpers["condition_adult"].Groups); !reflect.DeepEqual(got, []string{"pets", "store"}) {
+		t.Errorf("groups of condition_adult %v, want [pets store]", got)
+	}
+	if got := sortedKeys(c.helpers["list_condition_adult(x)"].Groups); !reflect.DeepEqual(got, []string{"pets"}) {
+		t.Errorf("groups of list_condition_adult(x) %v, want [pets]", got)
+	}
+	if len(*c.sources) != 2 {
+		t.Errorf("sources %v, want the expressions of both helpers", *c.sources)
+	}
+
+	for _, name := range []string{"unknown", conditionRefPrefix + "adult"} {
+		if _, err := c.call(conditionOp, []interface{}{name}, oasSecExtRegoBooleanFilter, "pets"); err == nil {
+			t.Errorf("no error for the unknown condition %v", name)
+		}
+	}
+	if _, err := c.call(refOp, []interface{}{"#/components/schemas/adult"}, oasSecExtRegoBooleanFilter, "pets"); err == nil {
+		t.Errorf("no error for the reference outside of the conditions")
+	}
+}
+
+func TestConditionHelpersPolicy(t *testing.T) {
+	swagger := loadTestSpec(t, `
+openapi: 3.0.0
+info: {title: conditions, version: "1"}
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      x-security-rego-list-filter:
+        - source: list
+          operations:
+            - condition: adult
+      x-security-rego-overwrite-filter:
+        - field: name
+          value: '"hidden"'
+          rules:
+            - operations:
+                - condition: adult
+      responses: {"200": {description: ok}}
+  /pets/{petId}:
+    get:
+      operationId: showPetById
+      x-security-rego-boolean-filter:
+        - rules:
+            - operations:
+                - condition: owns_pet
+      responses: {"200": {description: ok}}
+    delete:
+      operationId: deletePet
+      x-security-rego-boolean-filter:
+        - rules:
+            - operations:
+                - $ref: '#/components/x-security-rego-conditions/owns_pet'
+      responses: {"200": {description: ok}}
+components:
+  x-security-rego-conditions:
+    adult:
+      - gte: [age, 18]
+    owns_pet:
+      - eq: ['$petId', 'token.payload.pets[_].petId']
+`)
+
+	result, err := NewGenerator().Generate(swagger)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	checkRegoFiles(t, result.Files)
+
+	content := result.Files[0].Content
+	for _, helper := range []string{"list_condition_adult(x)", "overwrite_condition_adult", "condition_owns_pet(petId)"} {
+		// each helper is defined once, whatever the number of operations calling it
+		if n := strings.Count(content, "\n"+helper+" "); n != 1 {
+			t.Errorf("helper %v defined %d times, want once:\n%v", helper, n, content)
+		}
+	}
+}
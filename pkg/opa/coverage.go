@@ -0,0 +1,127 @@
+package opa
+
+import (
+	"fmt"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// OperationCoverage lists the protections the generated policy applies to an operation
+type OperationCoverage struct {
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	OperationID string `json:"operation_id"`
+
+	// Scopes are the alternative security requirements of the spec, each mapping the
+	// security schemes to the scopes they require
+	Scopes []map[string][]string `json:"scopes"`
+
+	// Roles are the roles allowed to the operation, including the roles inheriting them
+	Roles []string `json:"roles"`
+
+	// Conditions is the number of allow rules with conditions
+	Conditions int `json:"conditions"`
+
+	// Tenant is the source of the tenant of the request every allow rule compares
+	// with the tenant of the user, empty if the operation is not checked
+	Tenant string `json:"tenant"`
+
+	// FieldFilters are the security schemes the response fields are filtered for
+	FieldFilters []string `json:"field_filters"`
+
+	// ListFilters is the number of list filters
+	ListFilters int `json:"list_filters"`
+
+	// OverwriteFilters are the overwritten fields of the response object
+	OverwriteFilters []string `json:"overwrite_filters"`
+
+	// Inherited maps the extensions the operation inherits from the document, its tags
+	// or its path item to the levels their effective value is taken from
+	Inherited map[string][]string `json:"inherited"`
+
+	// Public is set for operations without roles or permissions which have no security
+	// requirements or an empty one, ie. allow anonymous access
+	Public bool `json:"public"`
+
+	// Unconstrained is set for operations allowed by a rule without conditions
+	Unconstrained bool `json:"unconstrained"`
+
+	// Denied is set for operations no rule allows, eg. by the deny strategy
+	Denied bool `json:"denied"`
+}
+
+// Protected returns whether the operation is denied, or requires security and is
+// only allowed under conditions
+func (c OperationCoverage) Protected() bool {
+	return c.Denied || !c.Public && !c.Unconstrained
+}
+
+// Coverage returns the protections the policy generated from the spec with the
+// options applies to each operation, in the order of the operations
+func Coverage(swagger *openapi3.Swagger, options Options) ([]OperationCoverage, error) {
+	model, err := buildModel(swagger, options)
+	if err != nil {
+		return nil, err
+	}
+	hierarchy, err := loadRoleHierarchy(swagger)
+	if err != nil {
+		return nil, err
+	}
+	tenant, _ := loadTenant(swagger)
+
+	coverage := []OperationCoverage{}
+	for _, o := range sortedOperations(swagger) {
+		m := model[fmt.Sprintf("%v %v", o.Method, o.Path)]
+		roles, _, err := operationRoles(o.Operation, hierarchy)
+		if err != nil {
+			return nil, err
+		}
+		if roles == nil {
+			roles = []string{}
+		}
+
+		c := OperationCoverage{
+			Method:           o.Method,
+			Path:             o.Path,
+			OperationID:      o.Operation.OperationID,
+			Scopes:           m.Security,
+			Roles:            roles,
+			FieldFilters:     sortedKeys(m.FilterFields),
+			OverwriteFilters: sortedKeys(m.Overwrites),
+			Public:           allowsAnonymous(m.Security) && len(roles) == 0 && options.Permissions == nil,
+			Denied:           len(m.AllowRules) == 0,
+			Inherited:        map[string][]string{},
+		}
+		if i, ok := tenant.operationSource(o, &Errors{}); ok {
+			c.Tenant = tenant.Sources[i]
+		}
+		for name, inherited := range o.Inherited {
+			if len(inherited.Levels) > 1 || inherited.Levels[0] != levelOperation {
+				c.Inherited[name] = inherited.Levels
+			}
+		}
+		for _, rule := range m.AllowRules {
+			if len(rule) == 0 {
+				c.Unconstrained = true
+			} else {
+				c.Conditions++
+			}
+		}
+		for _, filters := range m.ListFilters {
+			c.ListFilters += len(filters)
+		}
+		coverage = append(coverage, c)
+	}
+	return coverage, nil
+}
+
+// allowsAnonymous returns whether the security requirements allow requests without
+// credentials, ie. there are none or one of them is empty
+func allowsAnonymous(requirements []map[string][]string) bool {
+	for _, requirement := range requirements {
+		if len(requirement) == 0 {
+			return true
+		}
+	}
+	return len(requirements) == 0
+}
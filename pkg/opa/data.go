@@ -0,0 +1,741 @@
+package opa
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const (
+	// ModeRules generates a Rego rule for every operation in the spec
+	ModeRules = "rules"
+
+	// ModeData compiles the spec into data tables evaluated by a generic Rego policy
+	ModeData = "data"
+
+	// dataFileName is the name of the generated data file
+	dataFileName = "data.json"
+
+	// operand roots in the data tables. "x" is the object being evaluated by a list filter
+	listItemRoot = "x"
+
+	// maxRefPaths is the number of paths a reference is split into the evaluator
+	// follows at most, ie. one more than the "_" segments of the reference
+	maxRefPaths = 3
+
+	// scopesOp is the operation of the condition requiring one of the sets of
+	// scopes given as operands
+	scopesOp = "scopes"
+)
+
+// evaluatorTemplate is the generic policy evaluating the data tables. It does
+// not depend on the spec, only on the package name it is generated in.
+var evaluatorTemplate = `package {{.PackageName}}
+{{header}}default allow {{assign}} false
+
+{{tokenRule}}{{pathRule}}{{permissionsRules}}
+
+# routes with the method and number of path segments of the request
+candidates {{assign}} data.{{.PackageName}}.routes[{{input "method"}}][format_int(count({{input "path"}}), 10)]
+
+# matches binds the index of each candidate route matching the request path
+# to the values of its path parameters
+matches[i] {{assign}} params{{ifkw}} {
+  route := candidates[i]
+  not literal_mismatch(route)
+  params := {name: {{input "path"}}[j] | j := route.params[name]}
+}
+
+literal_mismatch(route){{ifkw}} {
+  [j, segment] := route.literals[_]
+  {{input "path"}}[j] != segment
+}
+
+matched_rules{{contains "id"}}{{ifkw}} {
+  matches[i] = params
+  rule := candidates[i].rules[_]
+  conditions_satisfied(rule.conditions, params, null)
+  id := rule.id
+}
+
+allow{{ifkw}} {
+  count(matched_rules) > 0
+}
+
+filter {{assign}} fields{{ifkw}} {
+  matches[i]
+  field_filter := candidates[i].field_filters[_]
+  not missing_scope(field_filter.scopes)
+  fields := field_filter.fields
+}
+
+list_filter{{contains "x"}}{{ifkw}} {
+  matches[i] = params
+  list := candidates[i].list_filters[_]
+  x := input[list.source][_]
+  conditions_satisfied(list.conditions, params, x)
+}
+
+response[field] = value{{ifkw}} {
+  matches[i] = params
+  overwrite := candidates[i].overwrite_filters[_]
+  overwritten(overwrite, params)
+  field := overwrite.field
+  value := operand_values(overwrite.value, params, null)[_]
+}
+
+response[field] = value{{ifkw}} {
+  matches[i] = params
+  overwrite := candidates[i].overwrite_filters[_]
+  not overwritten(overwrite, params)
+  field := overwrite.field
+  value := {{input "object"}}[field]
+}
+
+overwritten(overwrite, params){{ifkw}} {
+  not overwrite.negated
+  overwrite_rule_satisfied(overwrite, params)
+}
+
+overwritten(overwrite, params){{ifkw}} {
+  overwrite.negated
+  not overwrite_rule_satisfied(overwrite, params)
+}
+
+overwrite_rule_satisfied(overwrite, params){{ifkw}} {
+  conditions_satisfied(overwrite.rules[_], params, null)
+}
+
+missing_scope(scopes){{ifkw}} {
+  scope := scopes[_]
+  not token.payload.scopes[scope]
+}
+
+conditions_satisfied(conditions, params, x){{ifkw}} {
+  count([c | c := conditions[_]; condition(c, params, x)]) == count(conditions)
+}
+
+condition(c, params, x){{ifkw}} {
+  c.op == "eq"
+  pairs := operand_pairs(c, params, x)
+  [a, b] := pairs[_]
+  a == b
+}
+
+condition(c, params, x){{ifkw}} {
+  c.op == "membership"
+  pairs := operand_pairs(c, params, x)
+  [a, b] := pairs[_]
+  a == b
+}
+
+condition(c, params, x){{ifkw}} {
+  c.op == "lt"
+  pairs := operand_pairs(c, params, x)
+  [a, b] := pairs[_]
+  a < b
+}
+
+condition(c, params, x){{ifkw}} {
+  c.op == "gte"
+  pairs := operand_pairs(c, params, x)
+  [a, b] := pairs[_]
+  a >= b
+}
+
+condition(c, params, x){{ifkw}} {
+  c.op == "negation"
+  not truthy(c.operands[0], params, x)
+}
+
+condition(c, _, _){{ifkw}} {
+  c.op == "authenticated"
+  token.payload
+}
+
+condition(c, params, x){{ifkw}} {
+  c.op == "roles"
+  roles := {role | role := operand_values(c.operands[0], params, x)[_][_]}
+  count(roles & {role | role := c.operands[1].value[_]}) > 0
+}
+
+{{- if .Permissions}}
+
+condition(c, _, _){{ifkw}} {
+  c.op == "permitted"
+  permitted(user_roles, c.operands[0].value)
+}{{end}}
+
+condition(c, _, _){{ifkw}} {
+  c.op == "scopes"
+  scopes := c.operands[_].value
+  not missing_scope(scopes)
+}
+
+operand_pairs(c, params, x) {{assign}} pairs{{ifkw}} {
+  left := operand_values(c.operands[0], params, x)
+  right := operand_values(c.operands[1], params, x)
+  pairs := {[a, b] | a := left[_]; b := right[_]}
+}
+
+truthy(operand, params, x){{ifkw}} {
+  values := operand_values(operand, params, x)
+  values[_] != false
+}
+
+operand_values(operand, _, _) = values{{ifkw}} {
+  operand.type == "value"
+  values := {object.get(operand, "value", null)}
+}
+
+operand_values(operand, params, _) = values{{ifkw}} {
+  operand.type == "param"
+  values := {params[operand.name]}
+}
+
+operand_values(operand, _, x) = values{{ifkw}} {
+  operand.type == "ref"
+  values := ref_values(operand_root(operand.root, x), operand.paths)
+}
+
+{{- if .Resources}}
+
+operand_values(operand, params, _) = values{{ifkw}} {
+  operand.type == "data"
+  paths := [[resource_segment(s, params) | s := path[_]] | path := operand.paths[_]]
+  values := ref_values({{.Resources}}, paths)
+}
+
+resource_segment(s, params) = params[s.param]{{ifkw}} {
+  is_object(s)
+}
+
+resource_segment(s, _) = s{{ifkw}} {
+  not is_object(s)
+}{{end}}
+
+operand_root("token", _) = token
+operand_root("input", _) = input
+operand_root("x", x) = x
+
+# ref_values follows the paths of a reference from the document, every value
+# reached by a path is iterated before the next path is followed
+ref_values(doc, paths) = values{{ifkw}} {
+  count(paths) == 1
+  values := {v | v := value_at(doc, paths[0])}
+}
+
+ref_values(doc, paths) = values{{ifkw}} {
+  count(paths) == 2
+  values := {v | d := value_at(doc, paths[0]); v := value_at(d[_], paths[1])}
+}
+
+ref_values(doc, paths) = values{{ifkw}} {
+  count(paths) == 3
+  values := {v | d := value_at(doc, paths[0]); e := value_at(d[_], paths[1]); v := value_at(e[_], paths[2])}
+}
+
+# value_at is the value at the path of the document, undefined if there is none.
+# The document is wrapped to be read by object.get whatever its type.
+value_at(doc, path) {{assign}} value{{ifkw}} {
+  p := array.concat(["v"], path)
+  value := object.get({"v": doc}, p, 0)
+  value == object.get({"v": doc}, p, 1)
+}{{if .Decision}}
+
+default operation_id {{assign}} null
+
+operation_id {{assign}} id{{ifkw}} {
+  count(matches) == 1
+  matches[i]
+  id := candidates[i].id
+}
+
+decision {{assign}} {
+  "allowed": allow,
+  "reasons": reasons,
+  "matched_rules": matched_rules,
+  "operation_id": operation_id,
+}
+
+reasons{{contains "reason"}}{{ifkw}} {
+  matched_rules[id]
+  reason := sprintf("allowed by rule %v", [id])
+}
+
+reasons{{contains "reason"}}{{ifkw}} {
+  count(matches) == 0
+  reason := "no operation in the specification matches the request"
+}
+
+reasons{{contains "reason"}}{{ifkw}} {
+  not allow
+  matches[i]
+  id := candidates[i].rules[_].id
+  reason := sprintf("rule %v was not satisfied", [id])
+}{{end}}`
+
+// evaluator is the data the evaluator template is executed with
+type evaluator struct {
+	PackageName string
+	Decision    bool
+	Permissions bool
+
+	// Resources is the ref of the resource data, empty if the spec reads none
+	Resources string
+}
+
+// routeTable defines an operation in the data tables
+type routeTable struct {
+	ID               string                 `json:"id"`
+	Literals         [][]interface{}        `json:"literals"`
+	Params           map[string]int         `json:"params"`
+	Rules            []ruleTable            `json:"rules"`
+	FieldFilters     []fieldFilterTable     `json:"field_filters"`
+	ListFilters      []listFilterTable      `json:"list_filters"`
+	OverwriteFilters []overwriteFilterTable `json:"overwrite_filters"`
+}
+
+// ruleTable defines a rule allowing an operation in the data tables
+type ruleTable struct {
+	ID         string           `json:"id"`
+	Conditions []conditionTable `json:"conditions"`
+}
+
+// fieldFilterTable defines a field filter in the data tables
+type fieldFilterTable struct {
+	Scopes []string `json:"scopes"`
+	Fields []string `json:"fields"`
+}
+
+// listFilterTable defines a list filter in the data tables
+type listFilterTable struct {
+	Source     string           `json:"source"`
+	Conditions []conditionTable `json:"conditions"`
+}
+
+// overwriteFilterTable defines an overwrite filter in the data tables
+type overwriteFilterTable struct {
+	Field   string             `json:"field"`
+	Value   operandTable       `json:"value"`
+	Negated bool               `json:"negated"`
+	Rules   [][]conditionTable `json:"rules"`
+}
+
+// conditionTable defines an extension operation in the data tables
+type conditionTable struct {
+	Op       string         `json:"op"`
+	Operands []operandTable `json:"operands"`
+}
+
+// operandTable defines an operand of an extension operation. Type is one of
+// "value", "param", "ref" or "data". Refs are resolved from Root along Paths, data
+// from the resource data along Paths where objects are path parameters. A
+// reference is split into a path per "_", any key of the value reached by a path
+// is followed by the next one.
+type operandTable struct {
+	Type  string          `json:"type"`
+	Value interface{}     `json:"value,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Root  string          `json:"root,omitempty"`
+	Paths [][]interface{} `json:"paths,omitempty"`
+}
+
+// generateDataFiles compiles the spec into data tables and generates the generic
+// evaluator policy. The tables are indexed by method and number of path segments.
+func generateDataFiles(swagger *openapi3.Swagger, options Options) ([]File, []IndexedRule, error) {
+	if options.Layout != "" && options.Layout != LayoutSingle {
+		return nil, nil, fmt.Errorf("layout %v is not supported in %v mode", options.Layout, ModeData)
+	}
+	spec, errs, err := loadSpecModel(swagger, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(resourceReads(swagger, spec.conditions)) == 0 {
+		spec.resources = ""
+	}
+
+	routes := map[string]map[string][]routeTable{}
+	rules := []IndexedRule{}
+	for _, o := range sortedOperations(swagger) {
+		m, operationErrs := buildOperationModel(swagger, o, spec, options)
+		errs = append(errs, operationErrs...)
+		route, routeErrs := buildRouteTable(swagger, m, spec, options)
+		errs = append(errs, routeErrs...)
+
+		segments := strconv.Itoa(len(pathSegments(o.Path)))
+		if _, ok := routes[o.Method]; !ok {
+			routes[o.Method] = map[string][]routeTable{}
+		}
+		routes[o.Method][segments] = append(routes[o.Method][segments], route)
+
+		for _, rule := range route.Rules {
+			rules = append(rules, IndexedRule{
+				ID:          rule.ID,
+				OperationID: route.ID,
+				Path:        o.Path,
+				Method:      o.Method,
+				File:        dataFileName,
+			})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	// nest the tables under the package path so that they are loaded next to the evaluator
+	documents := map[string]interface{}{"routes": routes}
+	if options.Permissions != nil {
+		documents[permissionsDocument] = options.Permissions
+	}
+	data, err := packageData(options.PackageName, documents)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	funcs, err := templateFuncs(options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t, err := template.New("evaluator_template").Funcs(funcs).Parse(evaluatorTemplate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var buf bytes.Buffer
+	err = t.Execute(&buf, evaluator{
+		PackageName: options.PackageName,
+		Decision:    options.Decision,
+		Permissions: options.Permissions != nil,
+		Resources:   spec.resources,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return []File{
+		{Name: policyFileName, Content: buf.String()},
+		{Name: dataFileName, Content: data},
+	}, rules, nil
+}
+
+// buildRouteTable renders the model of an operation as a route table and returns
+// the errors found in the operands. The named conditions referenced are inlined.
+func buildRouteTable(swagger *openapi3.Swagger, m operationModel, spec specModel, options Options) (routeTable, Errors) {
+	input := options.Input.withDefaults()
+	route := routeTable{
+		ID:               m.ID,
+		Literals:         [][]interface{}{},
+		Params:           map[string]int{},
+		Rules:            []ruleTable{},
+		FieldFilters:     []fieldFilterTable{},
+		ListFilters:      []listFilterTable{},
+		OverwriteFilters: []overwriteFilterTable{},
+	}
+
+	for i, segment := range pathSegments(m.Path) {
+		if match := pathParamRE.FindStringSubmatch(segment); match != nil {
+			route.Params[match[1]] = i
+		} else {
+			route.Literals = append(route.Literals, []interface{}{i, segment})
+		}
+	}
+
+	var errs Errors
+
+	// the roles, the permissions and the tenant of the request are checked by
+	// every rule requiring them
+	checks := []conditionTable{}
+	if m.HasRoles {
+		root, claimPath, _ := parseRef(spec.claim)
+		checks = append(checks, conditionTable{Op: rolesOp, Operands: []operandTable{
+			{Type: "ref", Root: root, Paths: [][]interface{}{claimPath}},
+			{Type: "value", Value: m.Roles},
+		}})
+	}
+	if options.Permissions != nil {
+		checks = append(checks, conditionTable{Op: permittedOp, Operands: []operandTable{
+			{Type: "value", Value: permittedOperation(swagger, m.Operation)},
+		}})
+	}
+	if m.Isolated {
+		claim, _ := buildOperandTable(spec.tenant.claimRef(), "eq", oasSecExtRegoBooleanFilter, input)
+		source, _ := buildOperandTable(spec.tenant.Sources[m.Tenant], "eq", oasSecExtRegoBooleanFilter, input)
+		checks = append(checks, conditionTable{Op: "eq", Operands: []operandTable{claim, source}})
+	}
+
+	for _, f := range m.FieldFilters {
+		route.FieldFilters = append(route.FieldFilters, fieldFilterTable{Scopes: f.Scopes, Fields: f.Fields})
+	}
+
+	for _, f := range m.ListFilters {
+		conditions := buildConditionTables(f.Operations, oasSecExtRegoListFilter, pointerAt(f.Pointer, "operations"), input, spec.conditions, &errs)
+		route.ListFilters = append(route.ListFilters, listFilterTable{Source: f.Source, Conditions: conditions})
+	}
+
+	for _, f := range m.OverwriteFilters {
+		value, err := buildValueTable(f.Value, input)
+		if err != nil {
+			errs.add(pointerAt(f.Pointer, "value"), "%v", err)
+		}
+		overwrite := overwriteFilterTable{Field: f.Field, Value: value, Negated: f.Negated, Rules: [][]conditionTable{}}
+		for j, rule := range f.Rules {
+			conditions := buildConditionTables(rule.Operations, oasSecExtRegoOverwriteFilter, pointerAt(f.Pointer, "rules", j, "operations"), input, spec.conditions, &errs)
+			overwrite.Rules = append(overwrite.Rules, conditions)
+		}
+		route.OverwriteFilters = append(route.OverwriteFilters, overwrite)
+	}
+
+	for _, filter := range m.BooleanFilters {
+		for _, rule := range filter {
+			conditions := buildConditionTables(rule.Operations, oasSecExtRegoBooleanFilter, rule.Pointer, input, spec.conditions, &errs)
+			route.Rules = append(route.Rules, ruleTable{ID: rule.ID, Conditions: rule.conditions(checks, conditions)})
+		}
+	}
+	if rule := m.DefaultRule; rule != nil {
+		route.Rules = append(route.Rules, ruleTable{ID: rule.ID, Conditions: rule.conditions(checks, []conditionTable{})})
+	}
+
+	return route, errs
+}
+
+// conditions returns the conditions of a rule table, the checks of the operation
+// and the scopes the rule requires followed by the conditions of its operations
+func (r ruleModel) conditions(checks []conditionTable, operations []conditionTable) []conditionTable {
+	conditions := []conditionTable{}
+	if r.Authenticated {
+		conditions = append(conditions, conditionTable{Op: authenticatedOp, Operands: []operandTable{}})
+	}
+	if r.Checks {
+		conditions = append(conditions, checks...)
+	}
+	conditions = append(conditions, scopesConditions(r.Scopes)...)
+	return append(conditions, operations...)
+}
+
+// scopesConditions returns the condition requiring one of the alternative sets of
+// scopes, or no condition if no scopes are required
+func scopesConditions(requiredScopes [][]string) []conditionTable {
+	if len(requiredScopes) == 0 {
+		return nil
+	}
+
+	condition := conditionTable{Op: scopesOp, Operands: []operandTable{}}
+	for _, scopes := range requiredScopes {
+		condition.Operands = append(condition.Operands, operandTable{Type: "value", Value: scopes})
+	}
+	return []conditionTable{condition}
+}
+
+// buildConditionTables compiles the operations of an extension into conditions.
+// Operands are interpreted like in the generated rules of the extension, the
+// conditions of the named conditions referenced are inlined. The errors found are
+// added to errs, located below the pointer to the operations.
+func buildConditionTables(operations []operation, extension string, pointer []interface{}, input InputFields, named namedConditions, errs *Errors) []conditionTable {
+	conditions := []conditionTable{}
+	for k, operation := range operations {
+		for _, op := range sortedKeys(operation) {
+			operationPointer := pointerAt(pointer, k, op)
+			if isReference(op) {
+				name, err := named.reference(op, operation[op])
+				if err != nil {
+					errs.add(operationPointer, "%v", err)
+					continue
+				}
+				conditions = append(conditions, buildConditionTables(named[name], extension, conditionPointer(name), input, named, errs)...)
+				continue
+			}
+			if _, ok := opNameToSymbol[op]; !ok {
+				errs.add(operationPointer, "unknown operation %v", op)
+				continue
+			}
+
+			condition := conditionTable{Op: op, Operands: []operandTable{}}
+			for n, operand := range operation[op] {
+				o, err := buildOperandTable(operand, op, extension, input)
+				if err != nil {
+					errs.add(pointerAt(operationPointer, n), "%v", err)
+					continue
+				}
+				condition.Operands = append(condition.Operands, o)
+			}
+			conditions = append(conditions, condition)
+		}
+	}
+	return conditions
+}
+
+func buildOperandTable(operand interface{}, op string, extension string, input InputFields) (operandTable, error) {
+	if ref, ok := dataOperand(operand); ok {
+		return buildDataOperandTable(ref, op)
+	}
+
+	val, ok := operand.(string)
+	if !ok {
+		switch operand.(type) {
+		case bool, int64, float64:
+			return operandTable{Type: "value", Value: operand}, nil
+		default:
+			return operandTable{}, fmt.Errorf("illegal type for operand: %T", operand)
+		}
+	}
+
+	if strings.HasPrefix(val, pathTemplatePrefix) {
+		return operandTable{Type: "param", Name: strings.TrimLeft(val, pathTemplatePrefix)}, nil
+	}
+
+	switch extension {
+	case oasSecExtRegoListFilter:
+		if !strings.HasPrefix(val, tokenPrefix) && !strings.HasPrefix(val, inputPrefix) {
+			val = fmt.Sprintf("%v.%v", listItemRoot, val)
+		} else if op == "membership" {
+			val = fmt.Sprintf("%v[_]", val)
+		}
+	case oasSecExtRegoOverwriteFilter:
+		if !strings.HasPrefix(val, tokenPrefix) && !strings.HasPrefix(val, "\"") {
+			val = fmt.Sprintf("%v.%v.%v", inputPrefix, input.Object, val)
+		} else if op == "membership" && strings.HasPrefix(val, tokenPrefix) {
+			val = fmt.Sprintf("%v[_]", val)
+		}
+	default:
+		if op == "membership" {
+			val = fmt.Sprintf("%v[_]", val)
+		}
+	}
+
+	// quoted strings, numbers and booleans are values
+	var value interface{}
+	if err := json.Unmarshal([]byte(val), &value); err == nil {
+		return operandTable{Type: "value", Value: value}, nil
+	}
+
+	root, path, err := parseRef(val)
+	if err != nil {
+		return operandTable{}, err
+	}
+	if root != tokenPrefix && root != inputPrefix && root != listItemRoot {
+		return operandTable{}, fmt.Errorf("operand %v must reference %v or %v in %v mode", val, tokenPrefix, inputPrefix, ModeData)
+	}
+	paths, err := splitRefPath(val, path)
+	if err != nil {
+		return operandTable{}, err
+	}
+	return operandTable{Type: "ref", Root: root, Paths: paths}, nil
+}
+
+// buildValueTable compiles the value of an overwrite filter. The value is a Rego
+// term read like an operand of a boolean filter, null if not set.
+func buildValueTable(value interface{}, input InputFields) (operandTable, error) {
+	if value == nil {
+		return operandTable{Type: "value"}, nil
+	}
+	return buildOperandTable(value, "eq", oasSecExtRegoBooleanFilter, input)
+}
+
+// buildDataOperandTable compiles a reference into the resource data. Path parameters
+// are resolved by the evaluator, membership reads any item of the value.
+func buildDataOperandTable(ref string, op string) (operandTable, error) {
+	segments, err := parseDataRef(ref)
+	if err != nil {
+		return operandTable{}, err
+	}
+
+	path := []interface{}{}
+	for _, segment := range segments {
+		if s, ok := segment.(string); ok && strings.HasPrefix(s, pathTemplatePrefix) {
+			segment = map[string]string{"param": strings.TrimLeft(s, pathTemplatePrefix)}
+		}
+		path = append(path, segment)
+	}
+	if op == "membership" {
+		path = append(path, "_")
+	}
+	paths, err := splitRefPath(ref, path)
+	if err != nil {
+		return operandTable{}, err
+	}
+	return operandTable{Type: dataOperandType, Paths: paths}, nil
+}
+
+// splitRefPath splits the path of a reference at its "_" segments into the paths
+// the evaluator follows one after the other
+func splitRefPath(ref string, path []interface{}) ([][]interface{}, error) {
+	paths := [][]interface{}{{}}
+	for _, segment := range path {
+		if segment == "_" {
+			paths = append(paths, []interface{}{})
+			continue
+		}
+		paths[len(paths)-1] = append(paths[len(paths)-1], segment)
+	}
+	if len(paths) > maxRefPaths {
+		return nil, fmt.Errorf("reference %v has more than %v \"_\" segments in %v mode", ref, maxRefPaths-1, ModeData)
+	}
+	return paths, nil
+}
+
+// parseRef splits a reference such as token.payload.pets[_].petId into its root
+// and the path below it. Brackets hold a wildcard, a number or a quoted string.
+func parseRef(ref string) (string, []interface{}, error) {
+	path := []interface{}{}
+	var root string
+	if ref == "" {
+		return "", nil, fmt.Errorf("illegal reference %v", ref)
+	}
+
+	rest := ref
+	for i := 0; rest != ""; i++ {
+		var segment interface{}
+		switch {
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return "", nil, fmt.Errorf("illegal reference %v", ref)
+			}
+			key := rest[1:end]
+			rest = rest[end+1:]
+			if key == "_" {
+				segment = key
+			} else if err := json.Unmarshal([]byte(key), &segment); err != nil {
+				return "", nil, fmt.Errorf("illegal reference %v", ref)
+			}
+		default:
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			rest = rest[end:]
+			if key == "" || strings.ContainsAny(key, " \"=<>()") {
+				return "", nil, fmt.Errorf("illegal reference %v", ref)
+			}
+			segment = key
+		}
+
+		if i == 0 {
+			root, _ = segment.(string)
+			if root == "" {
+				return "", nil, fmt.Errorf("illegal reference %v", ref)
+			}
+			continue
+		}
+		path = append(path, segment)
+	}
+	return root, path, nil
+}
+
+// unmarshalExtension unmarshals the value of an OpenAPI extension
+func unmarshalExtension(val interface{}, v interface{}) error {
+	data, ok := val.(json.RawMessage)
+	if !ok {
+		return fmt.Errorf("OpenAPI extensions: type assertion error")
+	}
+	return json.Unmarshal(data, v)
+}
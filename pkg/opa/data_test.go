@@ -0,0 +1,137 @@
+package opa
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		ref  string
+		root string
+		path []interface{}
+		err  bool
+	}{
+		{ref: "input", root: "input", path: []interface{}{}},
+		{ref: "token.payload.sub", root: "token", path: []interface{}{"payload", "sub"}},
+		{ref: "token.payload.pets[_].petId", root: "token", path: []interface{}{"payload", "pets", "_", "petId"}},
+		{ref: `input.headers["x-tenant"]`, root: "input", path: []interface{}{"headers", "x-tenant"}},
+		{ref: "input.headers.x-tenant", root: "input", path: []interface{}{"headers", "x-tenant"}},
+		{ref: "input.items[0].id", root: "input", path: []interface{}{"items", float64(0), "id"}},
+		{ref: "$petId", root: "$petId", path: []interface{}{}},
+		{ref: "", err: true},
+		{ref: "input.items[0", err: true},
+		{ref: "input.items[x]", err: true},
+		{ref: "input..id", err: true},
+		{ref: "input.a b", err: true},
+		{ref: `input.a="b"`, err: true},
+		{ref: "[0].id", err: true},
+	}
+
+	for _, test := range tests {
+		root, path, err := parseRef(test.ref)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseRef(%q) = %v %v, want an error", test.ref, root, path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRef(%q): %v", test.ref, err)
+			continue
+		}
+		if root != test.root || !reflect.DeepEqual(path, test.path) {
+			t.Errorf("parseRef(%q) = %v %#v, want %v %#v", test.ref, root, path, test.root, test.path)
+		}
+	}
+}
+
+func TestBuildOperandTable(t *testing.T) {
+	tests := []struct {
+		operand   interface{}
+		op        string
+		extension string
+		want      operandTable
+		err       bool
+	}{
+		{
+			operand: "token.payload.sub", op: "eq", extension: oasSecExtRegoBooleanFilter,
+			want: operandTable{Type: "ref", Root: "token", Paths: [][]interface{}{{"payload", "sub"}}},
+		},
+		{
+			operand: "token.payload.pets[_].petId", op: "eq", extension: oasSecExtRegoBooleanFilter,
+			want: operandTable{Type: "ref", Root: "token", Paths: [][]interface{}{{"payload", "pets"}, {"petId"}}},
+		},
+		{
+			operand: "token.payload.pets[_].owners", op: "membership", extension: oasSecExtRegoBooleanFilter,
+			want: operandTable{Type: "ref", Root: "token", Paths: [][]interface{}{{"payload", "pets"}, {"owners"}, {}}},
+		},
+		{
+			operand: "input.items[0].id", op: "eq", extension: oasSecExtRegoBooleanFilter,
+			want: operandTable{Type: "ref", Root: "input", Paths: [][]interface{}{{"items", float64(0), "id"}}},
+		},
+		{
+			operand: "age", op: "gte", extension: oasSecExtRegoListFilter,
+			want: operandTable{Type: "ref", Root: "x", Paths: [][]interface{}{{"age"}}},
+		},
+		{
+			operand: map[string]interface{}{"data": "pets[$petId].owner"}, op: "eq", extension: oasSecExtRegoBooleanFilter,
+			want: operandTable{Type: "data", Paths: [][]interface{}{{"pets", map[string]string{"param": "petId"}, "owner"}}},
+		},
+		{
+			operand: map[string]interface{}{"data": "pets[$petId].vets"}, op: "membership", extension: oasSecExtRegoBooleanFilter,
+			want: operandTable{Type: "data", Paths: [][]interface{}{{"pets", map[string]string{"param": "petId"}, "vets"}, {}}},
+		},
+		{operand: "token.payload.a[_].b[_].c", op: "membership", extension: oasSecExtRegoBooleanFilter, err: true},
+		{operand: "token.payload.a[_].b[_].c[_]", op: "eq", extension: oasSecExtRegoBooleanFilter, err: true},
+	}
+
+	for _, test := range tests {
+		got, err := buildOperandTable(test.operand, test.op, test.extension, defaultInputFields)
+		if test.err {
+			if err == nil {
+				t.Errorf("buildOperandTable(%v, %v) = %#v, want an error", test.operand, test.op, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("buildOperandTable(%v, %v): %v", test.operand, test.op, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("buildOperandTable(%v, %v) = %#v, want %#v", test.operand, test.op, got, test.want)
+		}
+	}
+}
+
+func TestBuildValueTable(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  operandTable
+		err   bool
+	}{
+		{value: nil, want: operandTable{Type: "value"}},
+		{value: `"hello"`, want: operandTable{Type: "value", Value: "hello"}},
+		{value: float64(18), want: operandTable{Type: "value", Value: float64(18)}},
+		{value: false, want: operandTable{Type: "value", Value: false}},
+		{value: "token.payload.sub", want: operandTable{Type: "ref", Root: "token", Paths: [][]interface{}{{"payload", "sub"}}}},
+		{value: "hello world", err: true},
+	}
+
+	for _, test := range tests {
+		got, err := buildValueTable(test.value, defaultInputFields)
+		if test.err {
+			if err == nil {
+				t.Errorf("buildValueTable(%v) = %#v, want an error", test.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("buildValueTable(%v): %v", test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("buildValueTable(%v) = %#v, want %#v", test.value, got, test.want)
+		}
+	}
+}
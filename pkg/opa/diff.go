@@ -0,0 +1,398 @@
+package opa
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Kinds of changes reported by Diff
+const (
+	ChangeEndpointAdded      = "endpoint-added"
+	ChangeEndpointRemoved    = "endpoint-removed"
+	ChangeSecurityAdded      = "security-added"
+	ChangeSecurityRemoved    = "security-removed"
+	ChangeScopeAdded         = "scope-added"
+	ChangeScopeRemoved       = "scope-removed"
+	ChangeRequirementAdded   = "requirement-added"
+	ChangeRequirementRemoved = "requirement-removed"
+	ChangeFilterFieldAdded   = "filter-field-added"
+	ChangeFilterFieldRemoved = "filter-field-removed"
+	ChangeConditionLoosened  = "condition-loosened"
+	ChangeConditionTightened = "condition-tightened"
+	ChangeOverwriteAdded     = "overwrite-added"
+	ChangeOverwriteRemoved   = "overwrite-removed"
+	ChangeOverwriteChanged   = "overwrite-changed"
+)
+
+// Change is a change of the authorization of an endpoint between two versions of a spec
+type Change struct {
+	Kind     string `json:"kind"`
+	Endpoint string `json:"endpoint"`
+	Message  string `json:"message"`
+
+	// WidensAccess is set for changes which may allow requests or reveal data
+	// the old policy denied or hid
+	WidensAccess bool `json:"widens_access"`
+}
+
+// endpointModel is the authorization of an endpoint by the generated policy. Rules
+// are conjunctions of expressions of which one needs to be satisfied, an empty
+// rule is always satisfied.
+type endpointModel struct {
+	OperationID  string
+	Security     []map[string][]string
+	FilterFields map[string][]string
+	AllowRules   [][]string
+	ListFilters  map[string][][]string
+	Overwrites   map[string]overwriteModel
+}
+
+// overwriteModel is an overwrite of a field of the response object
+type overwriteModel struct {
+	Value   string
+	Negated bool
+	Rules   [][]string
+}
+
+// Diff compares the policies generated from an old and a new version of a spec with
+// the options. The policies are compared by the endpoints, security requirements and
+// expressions they are built from rather than by their text. Changes are ordered by
+// endpoint.
+func Diff(old *openapi3.Swagger, new *openapi3.Swagger, options Options) ([]Change, error) {
+	oldModel, err := buildModel(old, options)
+	if err != nil {
+		return nil, err
+	}
+	newModel, err := buildModel(new, options)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := map[string]bool{}
+	for endpoint := range oldModel {
+		endpoints[endpoint] = true
+	}
+	for endpoint := range newModel {
+		endpoints[endpoint] = true
+	}
+
+	changes := []Change{}
+	for _, endpoint := range sortedEndpoints(endpoints) {
+		o, inOld := oldModel[endpoint]
+		n, inNew := newModel[endpoint]
+		switch {
+		case !inOld:
+			changes = append(changes, Change{Kind: ChangeEndpointAdded, Endpoint: endpoint, Message: "endpoint is added", WidensAccess: true})
+		case !inNew:
+			changes = append(changes, Change{Kind: ChangeEndpointRemoved, Endpoint: endpoint, Message: "endpoint is removed"})
+		default:
+			changes = append(changes, diffEndpoint(endpoint, o, n)...)
+		}
+	}
+	return changes, nil
+}
+
+// sortedEndpoints returns the endpoints sorted by path and method like the operations
+func sortedEndpoints(endpoints map[string]bool) []string {
+	sorted := sortedKeys(endpoints)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return strings.SplitN(sorted[i], " ", 2)[1] < strings.SplitN(sorted[j], " ", 2)[1]
+	})
+	return sorted
+}
+
+// buildModel builds the authorization model of each endpoint, keyed by method and path,
+// from the policy generated from the spec
+func buildModel(swagger *openapi3.Swagger, options Options) (map[string]*endpointModel, error) {
+	p, err := buildPolicy(swagger, options)
+	if err != nil {
+		return nil, err
+	}
+
+	model := map[string]*endpointModel{}
+	keys := map[string]string{}
+	for i, o := range sortedOperations(swagger) {
+		endpoint := fmt.Sprintf("%v %v", o.Method, o.Path)
+		model[endpoint] = &endpointModel{
+			OperationID:  p.Operations[i].ID,
+			Security:     securityRequirements(swagger, o.Operation),
+			FilterFields: map[string][]string{},
+			ListFilters:  map[string][][]string{},
+			Overwrites:   map[string]overwriteModel{},
+		}
+		keys[p.Operations[i].Path+" "+p.Operations[i].Method] = endpoint
+	}
+
+	for _, schema := range p.Schemas {
+		m := model[keys[schema.Path+" "+schema.Method]]
+		switch {
+		case schema.FieldFilter != "":
+			var fields []string
+			err := json.Unmarshal([]byte(schema.FieldFilter), &fields)
+			if err != nil {
+				return nil, err
+			}
+			m.FilterFields[schema.Scheme] = fields
+		case schema.ListFilter != nil:
+			source := schema.ListFilter.Source
+			m.ListFilters[source] = append(m.ListFilters[source], expandConditions(schema.ListFilter.Expressions, p.Conditions))
+		case schema.OverwriteFilter != nil:
+			f := schema.OverwriteFilter
+			rules := [][]string{}
+			for _, expressions := range f.Expressions {
+				rules = append(rules, expandConditions(expressions, p.Conditions))
+			}
+			m.Overwrites[f.Field] = overwriteModel{
+				Value:   fmt.Sprintf("%v", f.Value),
+				Negated: f.Negated,
+				Rules:   rules,
+			}
+		case schema.BooleanFilter != nil:
+			// a rule is generated for every alternative set of scopes
+			for _, body := range schema.BooleanFilter.Bodies {
+				for _, scopes := range body.ScopeSets() {
+					expressions := []string{}
+					for _, scope := range scopes {
+						expressions = append(expressions, fmt.Sprintf("%v.payload.scopes[%q]", tokenPrefix, scope))
+					}
+					m.AllowRules = append(m.AllowRules, append(expressions, expandConditions(body.Expressions, p.Conditions)...))
+				}
+			}
+		default:
+			m.AllowRules = append(m.AllowRules, []string{})
+		}
+	}
+	return model, nil
+}
+
+// diffEndpoint compares the authorization of an endpoint
+func diffEndpoint(endpoint string, o *endpointModel, n *endpointModel) []Change {
+	changes := []Change{}
+	add := func(kind string, widens bool, format string, args ...interface{}) {
+		changes = append(changes, Change{Kind: kind, Endpoint: endpoint, Message: fmt.Sprintf(format, args...), WidensAccess: widens})
+	}
+
+	// alternative security requirements, accepting more requirements or requiring
+	// less scopes widens access
+	removed, added := diffRequirements(o.Security, n.Security)
+	if len(removed) == 1 && len(added) == 1 {
+		// a changed requirement is compared by its security schemes
+		oldScopes, newScopes := removed[0], added[0]
+		for _, scheme := range sortedKeys(mergeKeys(oldScopes, newScopes)) {
+			oldSchemeScopes, inOld := oldScopes[scheme]
+			newSchemeScopes, inNew := newScopes[scheme]
+			switch {
+			case !inOld:
+				add(ChangeSecurityAdded, false, "security scheme %v is required", scheme)
+			case !inNew:
+				add(ChangeSecurityRemoved, true, "security scheme %v is no longer required", scheme)
+			default:
+				for _, scope := range missing(newSchemeScopes, oldSchemeScopes) {
+					add(ChangeScopeAdded, false, "scope %v of security scheme %v is required", scope, scheme)
+				}
+				for _, scope := range missing(oldSchemeScopes, newSchemeScopes) {
+					add(ChangeScopeRemoved, true, "scope %v of security scheme %v is no longer required", scope, scheme)
+				}
+			}
+		}
+	} else {
+		for _, requirement := range removed {
+			add(ChangeRequirementRemoved, false, "security requirement %v is no longer accepted", formatRequirement(requirement))
+		}
+		for _, requirement := range added {
+			add(ChangeRequirementAdded, true, "security requirement %v is accepted", formatRequirement(requirement))
+		}
+	}
+
+	// fields filtered from the response, filtering less fields widens access
+	for _, scheme := range sortedKeys(mergeKeys(o.FilterFields, n.FilterFields)) {
+		for _, field := range missing(n.FilterFields[scheme], o.FilterFields[scheme]) {
+			add(ChangeFilterFieldAdded, false, "field %v is filtered for security scheme %v", field, scheme)
+		}
+		for _, field := range missing(o.FilterFields[scheme], n.FilterFields[scheme]) {
+			add(ChangeFilterFieldRemoved, true, "field %v is no longer filtered for security scheme %v", field, scheme)
+		}
+	}
+
+	// rules allowing the request, looser rules widen access
+	for _, c := range diffRules(o.AllowRules, n.AllowRules) {
+		add(c.kind, c.kind == ChangeConditionLoosened, "allow %v", c.message)
+	}
+
+	// list filters keeping the objects of a list, looser filters widen access
+	for _, source := range sortedKeys(mergeKeys(o.ListFilters, n.ListFilters)) {
+		for _, c := range diffRules(o.ListFilters[source], n.ListFilters[source]) {
+			add(c.kind, c.kind == ChangeConditionLoosened, "list filter of %v: %v", source, c.message)
+		}
+	}
+
+	// overwrites hiding a field of the response object, overwriting less often widens access
+	for _, field := range sortedKeys(mergeKeys(o.Overwrites, n.Overwrites)) {
+		oldOverwrite, inOld := o.Overwrites[field]
+		newOverwrite, inNew := n.Overwrites[field]
+		switch {
+		case !inOld:
+			add(ChangeOverwriteAdded, false, "field %v is overwritten", field)
+		case !inNew:
+			add(ChangeOverwriteRemoved, true, "field %v is no longer overwritten", field)
+		case oldOverwrite.Negated != newOverwrite.Negated:
+			add(ChangeOverwriteChanged, true, "field %v is overwritten when the rules are %vsatisfied", field, map[bool]string{true: "not ", false: ""}[newOverwrite.Negated])
+		default:
+			if oldOverwrite.Value != newOverwrite.Value {
+				add(ChangeOverwriteChanged, true, "field %v is overwritten with %v instead of %v", field, newOverwrite.Value, oldOverwrite.Value)
+			}
+			for _, c := range diffRules(oldOverwrite.Rules, newOverwrite.Rules) {
+				// a negated overwrite applies when its rules are not satisfied
+				widens := (c.kind == ChangeConditionLoosened) == newOverwrite.Negated
+				add(c.kind, widens, "overwrite of field %v: %v", field, c.message)
+			}
+		}
+	}
+	return changes
+}
+
+// diffRequirements returns the alternative security requirements removed from and
+// added to the old ones. No requirements are an empty requirement, ie. anonymous
+// access, so that requiring security for the first time changes a requirement.
+func diffRequirements(old []map[string][]string, new []map[string][]string) ([]map[string][]string, []map[string][]string) {
+	if len(old) == 0 {
+		old = []map[string][]string{{}}
+	}
+	if len(new) == 0 {
+		new = []map[string][]string{{}}
+	}
+
+	oldKeys, newKeys := map[string]bool{}, map[string]bool{}
+	for _, requirement := range old {
+		oldKeys[formatRequirement(requirement)] = true
+	}
+	for _, requirement := range new {
+		newKeys[formatRequirement(requirement)] = true
+	}
+
+	removed, added := []map[string][]string{}, []map[string][]string{}
+	for _, requirement := range old {
+		if !newKeys[formatRequirement(requirement)] {
+			removed = append(removed, requirement)
+		}
+	}
+	for _, requirement := range new {
+		if !oldKeys[formatRequirement(requirement)] {
+			added = append(added, requirement)
+		}
+	}
+	return removed, added
+}
+
+// formatRequirement formats a security requirement with its schemes and scopes
+// sorted, eg. "{api_key: [], petstore_auth: [read:pets write:pets]}"
+func formatRequirement(requirement map[string][]string) string {
+	schemes := []string{}
+	for _, scheme := range sortedKeys(requirement) {
+		schemes = append(schemes, fmt.Sprintf("%v: [%v]", scheme, strings.Join(requirement[scheme], " ")))
+	}
+	return fmt.Sprintf("{%v}", strings.Join(schemes, ", "))
+}
+
+// ruleChange is a change of a set of rules of which one needs to be satisfied
+type ruleChange struct {
+	kind    string
+	message string
+}
+
+// diffRules compares two sets of rules of which one needs to be satisfied. A rule
+// is compared by its expressions, a rule which has all the expressions of another
+// rule is at most as loose. An added rule loosens the set unless an old rule is as
+// loose, a removed rule tightens it unless a new rule is as loose.
+func diffRules(old [][]string, new [][]string) []ruleChange {
+	changes := []ruleChange{}
+
+	for _, rule := range new {
+		if coveredBy(rule, old) {
+			continue
+		}
+		message := fmt.Sprintf("rule is added: %v", formatRule(rule))
+		for _, o := range old {
+			if !containsRule(new, o) && len(missing(rule, o)) == 0 {
+				message = fmt.Sprintf("rule %v drops the conditions: %v", formatRule(o), strings.Join(missing(o, rule), "; "))
+				break
+			}
+		}
+		changes = append(changes, ruleChange{kind: ChangeConditionLoosened, message: message})
+	}
+
+	for _, rule := range old {
+		if coveredBy(rule, new) {
+			continue
+		}
+		message := fmt.Sprintf("rule is removed: %v", formatRule(rule))
+		for _, n := range new {
+			if !containsRule(old, n) && len(missing(rule, n)) == 0 {
+				message = fmt.Sprintf("rule %v adds the conditions: %v", formatRule(rule), strings.Join(missing(n, rule), "; "))
+				break
+			}
+		}
+		changes = append(changes, ruleChange{kind: ChangeConditionTightened, message: message})
+	}
+	return changes
+}
+
+// coveredBy returns whether one of the other rules is satisfied whenever the rule
+// is, ie. has a subset of its expressions
+func coveredBy(rule []string, others [][]string) bool {
+	for _, other := range others {
+		if len(missing(other, rule)) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// containsRule returns whether the rules contain a rule with the same expressions
+func containsRule(rules [][]string, rule []string) bool {
+	for _, r := range rules {
+		if len(missing(r, rule)) == 0 && len(missing(rule, r)) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// formatRule formats the expressions of a rule, "true" for a rule without expressions
+func formatRule(rule []string) string {
+	if len(rule) == 0 {
+		return "true"
+	}
+	return "{ " + strings.Join(rule, "; ") + " }"
+}
+
+// missing returns the values missing from the other values
+func missing(values []string, other []string) []string {
+	found := map[string]bool{}
+	for _, value := range other {
+		found[value] = true
+	}
+
+	result := []string{}
+	for _, value := range values {
+		if !found[value] {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// mergeKeys returns the union of the keys of two maps
+func mergeKeys(a interface{}, b interface{}) map[string]bool {
+	keys := map[string]bool{}
+	for _, m := range []interface{}{a, b} {
+		for _, key := range sortedKeys(m) {
+			keys[key] = true
+		}
+	}
+	return keys
+}
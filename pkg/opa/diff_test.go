@@ -0,0 +1,122 @@
+package opa
+
+import (
+	"reflect"
+	"testing"
+)
+
+// securitySpec returns a spec with a single operation of the security requirements
+func securitySpec(security string) string {
+	spec := "openapi: 3.0.0\ninfo: {title: security, version: \"1\"}\npaths:\n  /pets:\n    get:\n      responses: {\"200\": {description: ok}}\n"
+	if security != "" {
+		spec += "      security: " + security + "\n"
+	}
+	return spec
+}
+
+func TestDiffSecurity(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		changes []Change
+	}{
+		{
+			name: "alternative added",
+			old:  `[{oauth: [read]}]`,
+			new:  `[{oauth: [admin]}, {oauth: [read]}]`,
+			changes: []Change{
+				{Kind: ChangeRequirementAdded, Message: "security requirement {oauth: [admin]} is accepted", WidensAccess: true},
+			},
+		},
+		{
+			name: "alternative removed",
+			old:  `[{oauth: [admin]}, {oauth: [read]}]`,
+			new:  `[{oauth: [read]}]`,
+			changes: []Change{
+				{Kind: ChangeRequirementRemoved, Message: "security requirement {oauth: [admin]} is no longer accepted"},
+			},
+		},
+		{
+			name: "anonymous access added",
+			old:  `[{oauth: [read]}]`,
+			new:  `[{oauth: [read]}, {}]`,
+			changes: []Change{
+				{Kind: ChangeRequirementAdded, Message: "security requirement {} is accepted", WidensAccess: true},
+			},
+		},
+		{
+			name: "scope added to a requirement",
+			old:  `[{oauth: [read]}]`,
+			new:  `[{oauth: [write, read]}]`,
+			changes: []Change{
+				{Kind: ChangeScopeAdded, Message: "scope write of security scheme oauth is required"},
+			},
+		},
+		{
+			name: "security required",
+			new:  `[{oauth: [read]}]`,
+			changes: []Change{
+				{Kind: ChangeSecurityAdded, Message: "security scheme oauth is required"},
+			},
+		},
+		{
+			name: "security removed",
+			old:  `[{oauth: [read]}, {key: []}]`,
+			new:  `[]`,
+			changes: []Change{
+				{Kind: ChangeRequirementRemoved, Message: "security requirement {oauth: [read]} is no longer accepted"},
+				{Kind: ChangeRequirementRemoved, Message: "security requirement {key: []} is no longer accepted"},
+				{Kind: ChangeRequirementAdded, Message: "security requirement {} is accepted", WidensAccess: true},
+			},
+		},
+		{
+			name:    "alternatives reordered",
+			old:     `[{oauth: [read, write]}, {key: []}]`,
+			new:     `[{key: []}, {oauth: [write, read]}]`,
+			changes: []Change{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			old := loadTestSpec(t, securitySpec(test.old))
+			new := loadTestSpec(t, securitySpec(test.new))
+
+			changes, err := Diff(old, new, Options{PackageName: DefaultPackageName})
+			if err != nil {
+				t.Fatalf("Diff: %v", err)
+			}
+			for i := range test.changes {
+				test.changes[i].Endpoint = "GET /pets"
+			}
+			if !reflect.DeepEqual(changes, test.changes) {
+				t.Errorf("got changes %+v, want %+v", changes, test.changes)
+			}
+		})
+	}
+}
+
+func TestCoveragePublic(t *testing.T) {
+	tests := []struct {
+		security string
+		public   bool
+	}{
+		{security: "", public: true},
+		{security: `[]`, public: true},
+		{security: `[{oauth: [read]}, {}]`, public: true},
+		{security: `[{oauth: [read]}]`, public: false},
+		{security: `[{key: []}]`, public: false},
+	}
+
+	for _, test := range tests {
+		swagger := loadTestSpec(t, securitySpec(test.security))
+		coverage, err := Coverage(swagger, Options{PackageName: DefaultPackageName})
+		if err != nil {
+			t.Fatalf("Coverage: %v", err)
+		}
+		if coverage[0].Public != test.public {
+			t.Errorf("security %v: got public %v, want %v", test.security, coverage[0].Public, test.public)
+		}
+	}
+}
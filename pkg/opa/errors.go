@@ -0,0 +1,86 @@
+package opa
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Error is an error in the OpenAPI spec. It is located by a JSON pointer into the
+// spec and, when known, the file and line the pointer resolves to.
+type Error struct {
+	Pointer string
+	File    string
+	Line    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	location := e.Pointer
+	if e.File != "" {
+		location = fmt.Sprintf("%v:%v", e.File, e.Line)
+		if e.Line == 0 {
+			location = e.File
+		}
+		if e.Pointer != "" {
+			location += ": " + e.Pointer
+		}
+	}
+
+	if location == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%v: %v", location, e.Message)
+}
+
+// Errors are all the errors found in a run of the generator
+type Errors []*Error
+
+func (errs Errors) Error() string {
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Locate sets the file and line of the errors. The line of an error is looked up
+// by its pointer.
+func (errs Errors) Locate(file string, line func(pointer string) int) {
+	for _, e := range errs {
+		e.File = file
+		if e.Pointer != "" {
+			e.Line = line(e.Pointer)
+		}
+	}
+}
+
+// add adds an error located by the pointer tokens
+func (errs *Errors) add(pointer []interface{}, format string, args ...interface{}) {
+	*errs = append(*errs, &Error{Pointer: specPointer(pointer...), Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns the errors as error, or nil if there are none
+func (errs Errors) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// pointerAt returns the pointer tokens followed by the given tokens
+func pointerAt(pointer []interface{}, tokens ...interface{}) []interface{} {
+	return append(append([]interface{}{}, pointer...), tokens...)
+}
+
+// sortedKeys returns the sorted keys of a map with string keys so that the
+// extensions are processed in a deterministic order
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
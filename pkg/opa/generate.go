@@ -2,9 +2,9 @@ package opa
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
@@ -41,16 +41,31 @@ const (
 	pathTemplatePrefix = "$"
 
 	helperRuleName = "allow"
+
+	// RegoV0 generates the legacy Rego syntax supported by OPA versions before 1.0
+	RegoV0 = "v0"
+
+	// RegoV1 generates the Rego syntax of OPA 1.0, ie. with "if" and "contains"
+	RegoV1 = "v1"
+
+	// DefaultPackageName is the package of the generated policy if not configured
+	DefaultPackageName = "httpapi.authz"
 )
 
 var regoTemplate = `package %s
-default allow = false
+{{header}}default allow {{assign}} false
 
-token = {"payload": payload} { io.jwt.decode(input.token, [_, payload, _]) }{{range .}}{{ if .FieldFilter }}
+{{tokenRule}}{{pathRule}}{{permissionsRules}}{{range .Conditions}}
+
+{{.Call}}{{ifkw}} {
+{{- range .Expressions}}
+  {{.}}
+{{- end}}
+}{{end}}{{range .Schemas}}{{ if .FieldFilter }}
 
-filter = {{.FieldFilter}} {
-  input.path = {{.Path}}
-  input.method = {{.Method}}
+filter = {{.FieldFilter}}{{ifkw}} {
+  {{input "path"}} = {{.Path}}
+  {{input "method"}} = {{.Method}}
   {{- with .Scopes}}
   {{- range .}}
   token.payload.scopes["{{.}}"]
@@ -58,9 +73,9 @@ filter = {{.FieldFilter}} {
   {{- end}}
 }{{else if .ListFilter}}
 
-list_filter[x] {
-  input.path = {{.Path}}
-  input.method = {{.Method}}
+list_filter{{contains "x"}}{{ifkw}} {
+  {{input "path"}} = {{.Path}}
+  {{input "method"}} = {{.Method}}
   x := input.{{.ListFilter.Source}}[_]
   {{- with .ListFilter.Expressions}}
   {{- range .}}
@@ -69,48 +84,171 @@ list_filter[x] {
   {{- end}}
 }{{else if .OverwriteFilter}}
 {{if eq .OverwriteFilter.Negated true}}
-response["{{.OverwriteFilter.Field}}"] = {{.OverwriteFilter.Value}} {
+response["{{.OverwriteFilter.Field}}"] = {{.OverwriteFilter.Value}}{{ifkw}} {
     not {{.OverwriteFilter.HelperRuleName}}
 }
 
-response["{{.OverwriteFilter.Field}}"] = input.object.{{.OverwriteFilter.Field}} {
+response["{{.OverwriteFilter.Field}}"] = {{input "object"}}.{{.OverwriteFilter.Field}}{{ifkw}} {
     {{.OverwriteFilter.HelperRuleName}}
 }{{else}}
-response["{{.OverwriteFilter.Field}}"] = {{.OverwriteFilter.Value}} {
+response["{{.OverwriteFilter.Field}}"] = {{.OverwriteFilter.Value}}{{ifkw}} {
     {{.OverwriteFilter.HelperRuleName}}
 }
 
-response["{{.OverwriteFilter.Field}}"] = input.object.{{.OverwriteFilter.Field}} {
+response["{{.OverwriteFilter.Field}}"] = {{input "object"}}.{{.OverwriteFilter.Field}}{{ifkw}} {
     not {{.OverwriteFilter.HelperRuleName}}
 }{{end}}{{ $helper := .OverwriteFilter.HelperRuleName }} {{$path := .Path}} {{$method := .Method}}
 {{range .OverwriteFilter.Expressions}}
-{{$helper}} = true {
-  input.path = {{$path}}
-  input.method = {{$method}}
+{{$helper}}{{ifkw}} {
+  {{input "path"}} = {{$path}}
+  {{input "method"}} = {{$method}}
 {{- range .}}
   {{.}}
 {{- end}}
 }
 {{end}}{{else if .BooleanFilter}} {{$path := .Path}} {{$method := .Method}}
-{{range .BooleanFilter.Expressions}}
+{{range .BooleanFilter.Bodies}}{{$body := .}}{{range .ScopeSets}}
 
-allow = true {
-  input.path = {{$path}}
-  input.method = {{$method}}
+{{if $.Decision}}matched_rules{{contains (printf "%%q" $body.ID)}}{{else}}allow{{end}}{{ifkw}} {
+  {{input "path"}} = {{$path}}
+  {{input "method"}} = {{$method}}
 {{- range .}}
+  token.payload.scopes[{{printf "%%q" .}}]
+{{- end}}
+{{- range $body.Expressions}}
   {{.}}
 {{- end}}
-}{{end}}{{else}}
+}{{end}}{{end}}{{else}}
+
+{{if $.Decision}}matched_rules{{contains (printf "%%q" .RuleID)}}{{else}}allow{{end}}{{ifkw}} {
+  {{input "path"}} = {{.Path}}
+  {{input "method"}} = {{.Method}}
+}{{end}}{{end}}{{if .Decision}}{{if not .HasRules}}
+
+matched_rules {{assign}} set(){{end}}
+
+allow{{ifkw}} {
+  count(matched_rules) > 0
+}
+{{range .Operations}}
+operations[{{printf "%%q" .ID}}] {{assign}} {{.Rules}}{{ifkw}} {
+  {{input "path"}} = {{.Path}}
+  {{input "method"}} = {{.Method}}
+}
+{{end}}
+default operation_id {{assign}} null
+
+operation_id {{assign}} id{{ifkw}} {
+  count(operations) == 1
+  operations[id]
+}
+
+decision {{assign}} {
+  "allowed": allow,
+  "reasons": reasons,
+  "matched_rules": matched_rules,
+  "operation_id": operation_id,
+}{{if .HasRules}}
+
+reasons{{contains "reason"}}{{ifkw}} {
+  matched_rules[id]
+  reason := sprintf("allowed by rule %%v", [id])
+}{{end}}
+
+reasons{{contains "reason"}}{{ifkw}} {
+  count(operations) == 0
+  reason := "no operation in the specification matches the request"
+}
+
+reasons{{contains "reason"}}{{ifkw}} {
+  not allow
+  id := operations[_][_]
+  reason := sprintf("rule %%v was not satisfied", [id])
+}{{end}}`
+
+// Options defines the settings used to generate the Rego policy
+type Options struct {
+	// PackageName is the package of the generated Rego policy
+	PackageName string
+
+	// Decision generates a "decision" object with the outcome, the reasons
+	// for it, the matched rules and the operationId of the request
+	Decision bool
+
+	// Layout determines how the policy is split into packages and files
+	Layout string
+
+	// Mode determines whether the spec is compiled into Rego rules or into
+	// data tables evaluated by a generic policy
+	Mode string
+
+	// RegoVersion is the syntax of the generated Rego, RegoV1 if not set
+	RegoVersion string
+
+	// Input defines the fields of the input document read by the policy
+	Input InputFields
 
-allow = true {
-  input.path = {{.Path}}
-  input.method = {{.Method}}
-}{{end}}{{end}}`
+	// TokenSource determines how the token is read from the input, TokenJWT if not set
+	TokenSource string
+
+	// Target is the integration the policy is generated for, TargetOPA if not set
+	Target string
+
+	// Strategy determines how operations without a boolean filter are allowed,
+	// StrategyAllow if not set
+	Strategy string
+
+	// RolesClaim is the claim of the token holding the roles of the user,
+	// DefaultRolesClaim if not set
+	RolesClaim string
+
+	// Resources is the document below data holding the resource data read by the
+	// data operands, DefaultResources if not set
+	Resources string
+
+	// Permissions are the operations each role is allowed. They are generated as
+	// data and every allow rule requires a role of the user to be permitted the
+	// operation.
+	Permissions *Permissions
+}
+
+// policy is the data the Rego template is executed with
+type policy struct {
+	Schemas    []PolicySchema
+	Operations []operationSchema
+	Conditions []conditionHelper
+	Decision   bool
+	Sources    []source
+	Rules      []IndexedRule
+}
+
+// HasRules returns whether the policy has a rule allowing an operation, which is
+// not the case if every operation is denied
+func (p policy) HasRules() bool {
+	for _, schema := range p.Schemas {
+		if schema.RuleID != "" || schema.BooleanFilter != nil && len(schema.BooleanFilter.Bodies) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// operationSchema defines an OpenAPI operation and the IDs of the rules which allow it
+type operationSchema struct {
+	ID     string
+	Group  string
+	Path   string
+	Method string
+	Rules  string
+}
 
 // PolicySchema defines the policy to generate
 type PolicySchema struct {
+	Group           string
+	RuleID          string
 	Path            string
 	Method          string
+	Scheme          string
 	Scopes          []string
 	FieldFilter     string
 	ListFilter      *policySchemaListFilter
@@ -120,29 +258,62 @@ type PolicySchema struct {
 
 // policySchemaListFilter defines the policy to generate from a list filter
 type policySchemaListFilter struct {
-	Source      string
-	Operations  []operation
-	Expressions []string
+	Source      string      `json:"source" required:"true" description:"Ref to the list of objects to filter"`
+	Operations  []operation `json:"operations" required:"true" description:"Operations of which all need to be satisfied by an object to keep it"`
+	Expressions []string    `json:"-"`
 }
 
 // policySchemaOverwriteFilter defines the policy to generate from a overwrite filter
 type policySchemaOverwriteFilter struct {
-	Field          string
-	Value          interface{}
-	Negated        bool
-	Rules          []rule
-	HelperRuleName string
-	Expressions    [][]string
+	Field          string      `json:"field" required:"true" description:"Field of the response object to overwrite"`
+	Value          interface{} `json:"value" description:"Value of the field, a Rego term, null if not set"`
+	Negated        bool        `json:"negated" description:"Overwrite the field when none of the rules is satisfied"`
+	Rules          []rule      `json:"rules" required:"true" description:"Rules of which one needs to be satisfied"`
+	HelperRuleName string      `json:"-"`
+	Expressions    [][]string  `json:"-"`
 }
 
 // policySchemaBooleanFilter defines the policy to generate from a boolean filter
 type policySchemaBooleanFilter struct {
-	Rules       []rule
-	Expressions [][]string
+	Rules        []rule     `json:"rules" required:"true" description:"Rules of which one needs to be satisfied"`
+	IgnoreScopes bool       `json:"ignore_scopes,omitempty" description:"Do not require the scopes of the security requirements of the operation next to the rules"`
+	Bodies       []ruleBody `json:"-"`
+}
+
+// ruleBody defines the expressions of a generated rule and the ID
+// pointing to the location in the spec it originates from. Scopes are
+// the alternative sets of scopes of which one is required next to the
+// expressions.
+type ruleBody struct {
+	ID          string
+	Expressions []string
+	Scopes      [][]string
+}
+
+// ScopeSets returns the alternative sets of scopes a rule is generated for, a
+// single empty set if the rule requires no scopes
+func (b ruleBody) ScopeSets() [][]string {
+	if len(b.Scopes) == 0 {
+		return [][]string{{}}
+	}
+	return b.Scopes
+}
+
+// expressions returns the expressions of an allow rule, the checks of the
+// operation the rule requires followed by the expressions of its operations
+func (r ruleModel) expressions(checks []string, operations []string) []string {
+	expressions := []string{}
+	if r.Authenticated {
+		expressions = append(expressions, authenticatedExpression)
+	}
+	if r.Checks {
+		expressions = append(expressions, checks...)
+	}
+	return append(expressions, operations...)
 }
 
 type rule struct {
-	Operations []operation
+	Operations []operation `json:"operations" required:"true" description:"Operations of which all need to be satisfied"`
 }
 
 type operation map[string][]interface{}
@@ -151,253 +322,446 @@ type extensionDefinition map[string][]string
 
 // Generate generates the Rego policy given a OpenAPI 3 spec
 func Generate(swagger *openapi3.Swagger, packageName string) (string, error) {
+	return GenerateWithOptions(swagger, Options{PackageName: packageName})
+}
 
-	schemas := []PolicySchema{}
+// GenerateWithOptions generates the Rego policy given a OpenAPI 3 spec and the generation options
+func GenerateWithOptions(swagger *openapi3.Swagger, options Options) (string, error) {
+	files, err := GenerateFiles(swagger, options)
+	if err != nil {
+		return "", err
+	}
 
-	for path, item := range swagger.Paths {
-		for method, operation := range item.Operations() {
+	if len(files) != 1 {
+		return "", fmt.Errorf("layout %v generates %d files", options.Layout, len(files))
+	}
+	return files[0].Content, nil
+}
 
-			// check for "x-security-rego-field-filter" extension
-			if val, ok := operation.ExtensionProps.Extensions[oasSecExtRegoFieldFilter]; ok {
+// GenerateFiles generates the Rego policy files given a OpenAPI 3 spec and the generation options
+func GenerateFiles(swagger *openapi3.Swagger, options Options) ([]File, error) {
+	result, err := generate(swagger, options)
+	if err != nil {
+		return nil, err
+	}
+	return result.Files, nil
+}
 
-				// security requirement object needs to exist as the "x-security-rego-field-filter"
-				// extension references it
-				// TODO: Update the filter to support operations
-				if operation.Security == nil {
-					return "", fmt.Errorf("OpenAPI spec does not specify a Security Requirement Object")
-				}
+// generate generates the Rego policy files and the index of the generated rules
+func generate(swagger *openapi3.Swagger, options Options) (*Result, error) {
+	result := &Result{}
+	var sources []source
 
-				securitySchemes := getSecuritySchemes(operation.Security)
+	switch options.Mode {
+	case "", ModeRules:
+		p, err := buildPolicy(swagger, options)
+		if err != nil {
+			return nil, err
+		}
 
-				data, ok := val.(json.RawMessage)
-				if !ok {
-					return "", fmt.Errorf("OpenAPI extensions: type assertion error")
-				}
-				var extensionDefinitions []extensionDefinition
-				err := json.Unmarshal(data, &extensionDefinitions)
-				if err != nil {
-					return "", err
-				}
+		result.Files, err = generateFiles(p, options)
+		if err != nil {
+			return nil, err
+		}
+		result.Rules = p.Rules
+		sources = p.Sources
+	case ModeData:
+		var err error
+		result.Files, result.Rules, err = generateDataFiles(swagger, options)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown mode %v, use %v or %v", options.Mode, ModeRules, ModeData)
+	}
 
-				for _, extensionDefinition := range extensionDefinitions {
-					for schemeName, maskFields := range extensionDefinition {
-
-						var scopes []string
-						var ok bool
-						if scopes, ok = securitySchemes[schemeName]; !ok {
-							return "", fmt.Errorf("Unknown security scheme %v in OpenAPI extension", schemeName)
-						}
-
-						schema := PolicySchema{
-							Path:        convertOASPathToParsedPath(path),
-							Method:      strconv.Quote(method),
-							Scopes:      scopes,
-							FieldFilter: getFormattedMaskFields(maskFields),
-						}
-						schemas = append(schemas, schema)
-					}
-				}
+	// the permissions are generated as data next to the rules, data tables include them
+	if options.Permissions != nil && options.Mode != ModeData {
+		file, err := permissionsFile(options)
+		if err != nil {
+			return nil, err
+		}
+		result.Files = append(result.Files, file)
+	}
+
+	// the rules of the target are added to the root policy
+	for i := range result.Files {
+		if result.Files[i].Name == policyFileName {
+			rules, err := targetRules(options, result.Files[i].Content)
+			if err != nil {
+				return nil, err
 			}
+			result.Files[i].Content += rules
+		}
+	}
 
-			// check for "x-security-rego-list-filter" extension
-			if val, ok := operation.ExtensionProps.Extensions[oasSecExtRegoListFilter]; ok {
-				data, ok := val.(json.RawMessage)
-				if !ok {
-					return "", fmt.Errorf("OpenAPI extensions: type assertion error")
-				}
+	// check the generated Rego so that invalid policies are reported at generation
+	// time rather than when they are loaded into OPA
+	err := checkFiles(result.Files, sources)
+	if err != nil {
+		return nil, err
+	}
 
-				var policySchemaListFilters []policySchemaListFilter
-				err := json.Unmarshal(data, &policySchemaListFilters)
-				if err != nil {
-					return "", err
-				}
+	result.ResourceSchema, err = resourceSchema(swagger, options)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
-				for _, p := range policySchemaListFilters {
-					expressions := []string{}
-					for _, operation := range p.Operations {
-						for op, operands := range operation {
-							expression := []string{}
-							for _, operand := range operands {
-								switch val := operand.(type) {
-								case string:
-									if strings.HasPrefix(val, pathTemplatePrefix) {
-										val = strings.TrimLeft(val, pathTemplatePrefix)
-									} else if !strings.HasPrefix(val, tokenPrefix) && !strings.HasPrefix(val, inputPrefix) {
-										val = fmt.Sprintf("x.%v", val)
-									} else {
-										if op == "membership" {
-											val = fmt.Sprintf("%v[_]", val)
-										}
-									}
-									expression = append(expression, val)
-								case bool:
-									expression = append(expression, strconv.FormatBool(val))
-								case int64:
-									expression = append(expression, strconv.FormatInt(val, 10))
-								case float64:
-									expression = append(expression, strconv.FormatInt(int64(val), 10))
-								default:
-									return "", fmt.Errorf("illegal type for operand: %T", val)
-								}
-							}
-							expressions = append(expressions, strings.Join(expression, opNameToSymbol[op]))
-						}
-					}
-					listFilter := policySchemaListFilter{
-						Source:      p.Source,
-						Expressions: expressions,
-					}
+// buildPolicy builds the data to execute the Rego template with from the OpenAPI 3 spec.
+// All the errors found in the extensions are returned as Errors.
+func buildPolicy(swagger *openapi3.Swagger, options Options) (policy, error) {
+	spec, errs, err := loadSpecModel(swagger, options)
+	if err != nil {
+		return policy{}, err
+	}
 
-					schema := PolicySchema{
-						Path:       convertOASPathToParsedPath(path),
-						Method:     strconv.Quote(method),
-						ListFilter: &listFilter,
-					}
-					schemas = append(schemas, schema)
-				}
-			}
+	schemas := []PolicySchema{}
+	operations := []operationSchema{}
+	sources := []source{}
+	rules := []IndexedRule{}
+	compiler := &expressionCompiler{
+		input:      options.Input.withDefaults(),
+		resources:  spec.resources,
+		conditions: spec.conditions,
+		helpers:    map[string]*conditionHelper{},
+		sources:    &sources,
+		errs:       &errs,
+	}
 
-			// check for "x-security-rego-overwrite-filter" extension
-			if val, ok := operation.ExtensionProps.Extensions[oasSecExtRegoOverwriteFilter]; ok {
-				data, ok := val.(json.RawMessage)
-				if !ok {
-					return "", fmt.Errorf("OpenAPI extensions: type assertion error")
-				}
+	for _, o := range sortedOperations(swagger) {
+		m, operationErrs := buildOperationModel(swagger, o, spec, options)
+		errs = append(errs, operationErrs...)
+
+		path, method := o.Path, o.Method
+		operationRuleIDs := []string{}
+		group := operationGroup(path, o.Operation, options.Layout)
+
+		// the roles, the permissions and the tenant of the request are checked by
+		// every allow rule requiring them
+		checks := []string{}
+		if m.HasRoles {
+			checks = append(checks, rolesExpression(spec.claim, m.Roles))
+			sources = append(sources, source{
+				Text:    spec.claim,
+				Pointer: specPointer(o.extensionPointer(oasSecExtRegoRoles)()...),
+			})
+		}
+		if options.Permissions != nil {
+			checks = append(checks, permittedExpression(swagger, o.Operation))
+		}
+		if m.Isolated {
+			checks = append(checks, spec.tenant.expression(m.Tenant))
+			sources = append(sources, source{
+				Text:    spec.tenant.expression(m.Tenant),
+				Pointer: specPointer(oasSecExtRegoTenant, "sources", m.Tenant),
+			})
+		}
 
-				var policySchemaOverwriteFilters []policySchemaOverwriteFilter
-				err := json.Unmarshal(data, &policySchemaOverwriteFilters)
-				if err != nil {
-					return "", err
-				}
+		for _, f := range m.FieldFilters {
+			schema := PolicySchema{
+				Group:       group,
+				Path:        convertOASPathToParsedPath(path),
+				Method:      strconv.Quote(method),
+				Scheme:      f.Scheme,
+				Scopes:      f.Scopes,
+				FieldFilter: getFormattedMaskFields(f.Fields),
+			}
+			schemas = append(schemas, schema)
+			sources = append(sources, source{
+				Text:    schema.FieldFilter,
+				Pointer: specPointer(f.Pointer...),
+			})
+		}
 
-				for i, p := range policySchemaOverwriteFilters {
-					ruleExpressions := [][]string{}
-					for _, rule := range p.Rules {
-						expressions := []string{}
-						for _, operation := range rule.Operations {
-							for op, operands := range operation {
-								expression := []string{}
-								for _, operand := range operands {
-									switch val := operand.(type) {
-									case string:
-										if strings.HasPrefix(val, pathTemplatePrefix) {
-											val = strings.TrimLeft(val, pathTemplatePrefix)
-										} else if !strings.HasPrefix(val, tokenPrefix) && !strings.HasPrefix(val, "\"") {
-											val = fmt.Sprintf("input.object.%v", val)
-										} else {
-											if op == "membership" {
-												val = fmt.Sprintf("%v[_]", val)
-											}
-										}
-										expression = append(expression, val)
-									case bool:
-										expression = append(expression, strconv.FormatBool(val))
-									case int64:
-										expression = append(expression, strconv.FormatInt(val, 10))
-									case float64:
-										expression = append(expression, strconv.FormatInt(int64(val), 10))
-									default:
-										return "", fmt.Errorf("illegal type for operand: %T", val)
-									}
-								}
-								expressions = append(expressions, strings.Join(expression, opNameToSymbol[op]))
-							}
-						}
-						ruleExpressions = append(ruleExpressions, expressions)
-					}
+		for _, f := range m.ListFilters {
+			expressions := compiler.expressions(f.Operations, oasSecExtRegoListFilter, group, pointerAt(f.Pointer, "operations"))
+			sources = append(sources, source{
+				Text:    f.Source,
+				Pointer: specPointer(pointerAt(f.Pointer, "source")...),
+			})
+			schemas = append(schemas, PolicySchema{
+				Group:      group,
+				Path:       convertOASPathToParsedPath(path),
+				Method:     strconv.Quote(method),
+				ListFilter: &policySchemaListFilter{Source: f.Source, Expressions: expressions},
+			})
+		}
 
-					if p.Value == nil {
-						p.Value = "null"
-					}
+		for _, f := range m.OverwriteFilters {
+			ruleExpressions := [][]string{}
+			for j, rule := range f.Rules {
+				expressions := compiler.expressions(rule.Operations, oasSecExtRegoOverwriteFilter, group, pointerAt(f.Pointer, "rules", j, "operations"))
+				ruleExpressions = append(ruleExpressions, expressions)
+			}
 
-					overwriteFilter := policySchemaOverwriteFilter{
-						Field:          p.Field,
-						Value:          p.Value,
-						Negated:        p.Negated,
-						HelperRuleName: fmt.Sprintf("%v%v", helperRuleName, i+1),
-						Expressions:    ruleExpressions,
-					}
+			value := f.Value
+			if value == nil {
+				value = "null"
+			}
+			sources = append(sources, source{
+				Text:    fmt.Sprintf("%v", value),
+				Pointer: specPointer(pointerAt(f.Pointer, "value")...),
+			}, source{
+				Text:    f.Field,
+				Pointer: specPointer(pointerAt(f.Pointer, "field")...),
+			})
+
+			schemas = append(schemas, PolicySchema{
+				Group:  group,
+				Path:   convertOASPathToParsedPath(path),
+				Method: strconv.Quote(method),
+				OverwriteFilter: &policySchemaOverwriteFilter{
+					Field:          f.Field,
+					Value:          value,
+					Negated:        f.Negated,
+					HelperRuleName: fmt.Sprintf("%v%v", helperRuleName, f.Index+1),
+					Expressions:    ruleExpressions,
+				},
+			})
+		}
 
-					schema := PolicySchema{
-						Path:            convertOASPathToParsedPath(path),
-						Method:          strconv.Quote(method),
-						OverwriteFilter: &overwriteFilter,
-					}
-					schemas = append(schemas, schema)
-				}
+		for _, filter := range m.BooleanFilters {
+			bodies := []ruleBody{}
+			for _, rule := range filter {
+				expressions := compiler.expressions(rule.Operations, oasSecExtRegoBooleanFilter, group, rule.Pointer)
+				bodies = append(bodies, ruleBody{ID: rule.ID, Expressions: rule.expressions(checks, expressions), Scopes: rule.Scopes})
+				operationRuleIDs = append(operationRuleIDs, rule.ID)
 			}
 
-			// check for "x-security-rego-boolean-filter" extension
-			if val, ok := operation.ExtensionProps.Extensions[oasSecExtRegoBooleanFilter]; ok {
-				data, ok := val.(json.RawMessage)
-				if !ok {
-					return "", fmt.Errorf("OpenAPI extensions: type assertion error")
-				}
+			schemas = append(schemas, PolicySchema{
+				Group:         group,
+				Path:          convertOASPathToParsedPath(path),
+				Method:        strconv.Quote(method),
+				BooleanFilter: &policySchemaBooleanFilter{Bodies: bodies},
+			})
+		}
 
-				var policySchemaBooleanFilters []policySchemaBooleanFilter
-				err := json.Unmarshal(data, &policySchemaBooleanFilters)
-				if err != nil {
-					return "", err
+		if rule := m.DefaultRule; rule != nil {
+			schema := PolicySchema{
+				Group:  group,
+				RuleID: rule.ID,
+				Path:   convertOASPathToParsedPath(path),
+				Method: strconv.Quote(method),
+			}
+			if expressions := rule.expressions(checks, nil); len(expressions) > 0 {
+				schema.BooleanFilter = &policySchemaBooleanFilter{
+					Bodies: []ruleBody{{ID: rule.ID, Expressions: expressions, Scopes: rule.Scopes}},
 				}
+			}
+			schemas = append(schemas, schema)
+			operationRuleIDs = append(operationRuleIDs, rule.ID)
+		}
 
-				for _, p := range policySchemaBooleanFilters {
-					ruleExpressions := [][]string{}
-					for _, rule := range p.Rules {
-						expressions := []string{}
-						for _, operation := range rule.Operations {
-							for op, operands := range operation {
-								expression := []string{}
-								for _, operand := range operands {
-									switch val := operand.(type) {
-									case string:
-										if strings.HasPrefix(val, pathTemplatePrefix) {
-											val = strings.TrimLeft(val, pathTemplatePrefix)
-										} else if op == "membership" {
-											val = fmt.Sprintf("%v[_]", val)
-										} else if op == "negation" {
-											val = fmt.Sprintf("not %v", val)
-										}
-										expression = append(expression, val)
-									case bool:
-										expression = append(expression, strconv.FormatBool(val))
-									case int64:
-										expression = append(expression, strconv.FormatInt(val, 10))
-									case float64:
-										expression = append(expression, strconv.FormatInt(int64(val), 10))
-									default:
-										return "", fmt.Errorf("illegal type for operand: %T", val)
-									}
-								}
-								expressions = append(expressions, strings.Join(expression, opNameToSymbol[op]))
-							}
-						}
-						ruleExpressions = append(ruleExpressions, expressions)
-					}
+		operations = append(operations, operationSchema{
+			ID:     m.ID,
+			Group:  group,
+			Path:   convertOASPathToParsedPath(path),
+			Method: strconv.Quote(method),
+			Rules:  getFormattedMaskFields(operationRuleIDs),
+		})
+		for _, ruleID := range operationRuleIDs {
+			rules = append(rules, IndexedRule{
+				ID:          ruleID,
+				OperationID: m.ID,
+				Path:        path,
+				Method:      method,
+				File:        groupFileName(group),
+			})
+		}
+	}
 
-					booleanFilter := policySchemaBooleanFilter{
-						Expressions: ruleExpressions,
-					}
+	p := policy{
+		Schemas:    schemas,
+		Operations: operations,
+		Conditions: conditionHelpers(compiler.helpers),
+		Decision:   options.Decision,
+		Sources:    sources,
+		Rules:      rules,
+	}
+	return p, errs.err()
+}
+
+// expressionCompiler compiles the operations of the extensions into Rego expressions.
+// References to named conditions are compiled into calls of their helper rules, which
+// are collected with the groups calling them.
+type expressionCompiler struct {
+	input      InputFields
+	resources  string
+	conditions namedConditions
+	helpers    map[string]*conditionHelper
+	sources    *[]source
+	errs       *Errors
+}
 
-					schema := PolicySchema{
-						Path:          convertOASPathToParsedPath(path),
-						Method:        strconv.Quote(method),
-						BooleanFilter: &booleanFilter,
+// expressions compiles the operations of an extension of an operation of the group.
+// The pointer locates the operations in the spec.
+func (c *expressionCompiler) expressions(operations []operation, extension string, group string, pointer []interface{}) []string {
+	expressions := []string{}
+	for k, operation := range operations {
+		for _, op := range sortedKeys(operation) {
+			operands := operation[op]
+			operationPointer := pointerAt(pointer, k, op)
+
+			var expression string
+			switch _, ok := opNameToSymbol[op]; {
+			case isReference(op):
+				call, err := c.call(op, operands, extension, group)
+				if err != nil {
+					c.errs.add(operationPointer, "%v", err)
+					continue
+				}
+				expression = call
+			case !ok:
+				c.errs.add(operationPointer, "unknown operation %v", op)
+				continue
+			default:
+				terms := []string{}
+				for n, operand := range operands {
+					term, err := regoOperand(operand, op, extension, c.input, c.resources)
+					if err != nil {
+						c.errs.add(pointerAt(operationPointer, n), "%v", err)
+						continue
 					}
-					schemas = append(schemas, schema)
+					terms = append(terms, term)
 				}
+				expression = strings.Join(terms, opNameToSymbol[op])
 			}
 
-			// generate boolean rules if boolean filter not defined
-			if _, ok := operation.ExtensionProps.Extensions[oasSecExtRegoBooleanFilter]; !ok {
-				schema := PolicySchema{
-					Path:   convertOASPathToParsedPath(path),
-					Method: strconv.Quote(method),
-				}
-				schemas = append(schemas, schema)
-			}
+			expressions = append(expressions, expression)
+			*c.sources = append(*c.sources, source{
+				Text:    expression,
+				Pointer: specPointer(operationPointer...),
+			})
 		}
 	}
-	return generateRego(schemas, packageName)
+	return expressions
+}
+
+// call returns the call of the helper rule of the referenced condition for the
+// extension and compiles the rule when it is first called
+func (c *expressionCompiler) call(op string, operands []interface{}, extension string, group string) (string, error) {
+	name, err := c.conditions.reference(op, operands)
+	if err != nil {
+		return "", err
+	}
+
+	args := c.conditions.params(name)
+	if extension == oasSecExtRegoListFilter {
+		args = append([]string{"x"}, args...)
+	}
+	call := conditionRulePrefixes[extension] + name
+	if len(args) > 0 {
+		call = fmt.Sprintf("%v(%v)", call, strings.Join(args, ", "))
+	}
+
+	helper, ok := c.helpers[call]
+	if !ok {
+		helper = &conditionHelper{Call: call, Args: args, Groups: map[string]bool{}}
+		c.helpers[call] = helper
+		helper.Expressions = c.expressions(c.conditions[name], extension, group, conditionPointer(name))
+	}
+	helper.Groups[group] = true
+	return call, nil
+}
+
+// regoOperand renders an operand of an operation of the extension as a Rego term.
+// Path parameters are variables of the generated rules, fields are relative to the
+// list item in list filters and to the response object in overwrite filters. Data
+// references are relative to the resource data.
+func regoOperand(operand interface{}, op string, extension string, input InputFields, resources string) (string, error) {
+	if ref, ok := dataOperand(operand); ok {
+		segments, err := parseDataRef(ref)
+		if err != nil {
+			return "", err
+		}
+		val := regoRef(resources, segments)
+		switch {
+		case op == "membership":
+			val = fmt.Sprintf("%v[_]", val)
+		case op == "negation" && extension == oasSecExtRegoBooleanFilter:
+			val = fmt.Sprintf("not %v", val)
+		}
+		return val, nil
+	}
+
+	switch val := operand.(type) {
+	case string:
+		switch {
+		case strings.HasPrefix(val, pathTemplatePrefix):
+			val = strings.TrimLeft(val, pathTemplatePrefix)
+		case extension == oasSecExtRegoListFilter && !strings.HasPrefix(val, tokenPrefix) && !strings.HasPrefix(val, inputPrefix):
+			val = fmt.Sprintf("x.%v", val)
+		case extension == oasSecExtRegoOverwriteFilter && !strings.HasPrefix(val, tokenPrefix) && !strings.HasPrefix(val, "\""):
+			val = fmt.Sprintf("%v.%v.%v", inputPrefix, input.Object, val)
+		case op == "membership":
+			val = fmt.Sprintf("%v[_]", val)
+		case op == "negation" && extension == oasSecExtRegoBooleanFilter:
+			val = fmt.Sprintf("not %v", val)
+		}
+		return val, nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case int64:
+		return strconv.FormatInt(val, 10), nil
+	case float64:
+		return strconv.FormatInt(int64(val), 10), nil
+	default:
+		return "", fmt.Errorf("illegal type for operand: %T", val)
+	}
+}
+
+// operationRef references an operation in the OpenAPI spec. The extensions of the
+// operation are its effective extensions, Inherited records where they are defined.
+type operationRef struct {
+	Path      string
+	Method    string
+	Operation *openapi3.Operation
+	Inherited map[string]*inheritedExtension
+}
+
+// sortedOperations returns the operations of the OpenAPI spec sorted by path and method
+// so that the generated policy is deterministic. The operations are copies with the
+// extensions inherited from the document, their tags and their path item.
+func sortedOperations(swagger *openapi3.Swagger) []operationRef {
+	paths := make([]string, 0, len(swagger.Paths))
+	for path := range swagger.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	result := []operationRef{}
+	for _, path := range paths {
+		operations := swagger.Paths[path].Operations()
+
+		methods := make([]string, 0, len(operations))
+		for method := range operations {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			operation := *operations[method]
+			extensions, inherited := inheritExtensions(extensionLevels(swagger, path, method, operations[method]))
+			operation.Extensions = extensions
+			result = append(result, operationRef{Path: path, Method: method, Operation: &operation, Inherited: inherited})
+		}
+	}
+	return result
+}
+
+// specPointer returns a JSON pointer to a location in the OpenAPI spec. It is used
+// as a stable ID for the generated rules.
+func specPointer(tokens ...interface{}) string {
+	result := "#"
+	for _, token := range tokens {
+		value := fmt.Sprintf("%v", token)
+		value = strings.Replace(value, "~", "~0", -1)
+		value = strings.Replace(value, "/", "~1", -1)
+		result += "/" + value
+	}
+	return result
 }
 
 func getSecuritySchemes(secReqs *openapi3.SecurityRequirements) map[string][]string {
@@ -410,6 +774,52 @@ func getSecuritySchemes(secReqs *openapi3.SecurityRequirements) map[string][]str
 	return securitySchemesMap
 }
 
+// securityRequirements returns the alternative security requirements of the operation
+// or else the spec, mapping each security scheme to its sorted scopes. An empty
+// requirement makes security optional.
+func securityRequirements(swagger *openapi3.Swagger, operation *openapi3.Operation) []map[string][]string {
+	security := swagger.Security
+	if operation.Security != nil {
+		security = *operation.Security
+	}
+
+	requirements := []map[string][]string{}
+	for _, requirement := range security {
+		schemes := map[string][]string{}
+		for scheme, scopes := range requirement {
+			schemes[scheme] = append([]string{}, scopes...)
+			sort.Strings(schemes[scheme])
+		}
+		requirements = append(requirements, schemes)
+	}
+	return requirements
+}
+
+// scopeAlternatives returns the scopes required by each alternative security
+// requirement of the operation or else the spec, sorted so that the generated
+// policy is deterministic. No scopes are required if security is optional or an
+// alternative requires no scope.
+func scopeAlternatives(swagger *openapi3.Swagger, operation *openapi3.Operation) [][]string {
+	security := swagger.Security
+	if operation.Security != nil {
+		security = *operation.Security
+	}
+
+	alternatives := [][]string{}
+	for _, requirement := range security {
+		scopes := []string{}
+		for _, scheme := range sortedKeys(requirement) {
+			scopes = append(scopes, missing(requirement[scheme], scopes)...)
+		}
+		if len(scopes) == 0 {
+			return nil
+		}
+		sort.Strings(scopes)
+		alternatives = append(alternatives, scopes)
+	}
+	return alternatives
+}
+
 func getFormattedMaskFields(maskFields []string) string {
 	result := make([]string, len(maskFields))
 
@@ -420,19 +830,51 @@ func getFormattedMaskFields(maskFields []string) string {
 	return fmt.Sprintf("[%v]", strings.Join(result, ","))
 }
 
-func generateRego(schemas []PolicySchema, packageName string) (string, error) {
+// regoFuncs returns the template functions rendering the keywords and operators
+// which differ between the Rego versions:
+//   header    imports rego.v1 in v1
+//   assign    "=" in v0 and ":=" in v1
+//   ifkw      "" in v0 and " if" in v1
+//   contains  "[x]" in v0 and " contains x" in v1
+func regoFuncs(regoVersion string) (template.FuncMap, error) {
+	switch regoVersion {
+	case RegoV0:
+		return template.FuncMap{
+			"header":   func() string { return "" },
+			"assign":   func() string { return "=" },
+			"ifkw":     func() string { return "" },
+			"contains": func(key string) string { return fmt.Sprintf("[%v]", key) },
+		}, nil
+	case "", RegoV1:
+		return template.FuncMap{
+			"header":   func() string { return "import rego.v1\n" },
+			"assign":   func() string { return ":=" },
+			"ifkw":     func() string { return " if" },
+			"contains": func(key string) string { return fmt.Sprintf(" contains %v", key) },
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown Rego version %v, use %v or %v", regoVersion, RegoV0, RegoV1)
+	}
+}
+
+func generateRego(p policy, packageName string, options Options) (string, error) {
 
 	policyTemplate := fmt.Sprintf(regoTemplate, packageName)
 
-	t := template.New("policy_template")
-	t, err := t.Parse(policyTemplate)
+	funcs, err := templateFuncs(options)
+	if err != nil {
+		return "", err
+	}
+
+	t := template.New("policy_template").Funcs(funcs)
+	t, err = t.Parse(policyTemplate)
 	if err != nil {
 		return "", err
 	}
 
 	var buf bytes.Buffer
 
-	err = t.Execute(&buf, schemas)
+	err = t.Execute(&buf, p)
 	if err != nil {
 		return "", err
 	}
@@ -453,7 +895,7 @@ func generateRego(schemas []PolicySchema, packageName string) (string, error) {
 //   {?param*}
 func convertOASPathToParsedPath(path string) string {
 	match := pathParamRE.ReplaceAllString(path, ":$1")
-	splitPath := strings.Split(strings.TrimLeft(match, "/"), "/")
+	splitPath := pathSegments(match)
 
 	// add "["
 	result := "["
@@ -468,10 +910,16 @@ func convertOASPathToParsedPath(path string) string {
 
 	// add "]"
 	result = strings.TrimSuffix(strings.TrimSpace(result), ",") + "]"
+	return result
+}
 
-	// handle root path
-	if result == "[\"\"]" {
-		return "[\"/\"]"
+// pathSegments splits a path of the spec into its segments the same way the rule
+// splitting a raw request path does: a trailing slash is dropped and the root path
+// is the single segment "/"
+func pathSegments(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return []string{"/"}
 	}
-	return result
+	return strings.Split(trimmed, "/")
 }
@@ -0,0 +1,167 @@
+package opa
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScopeAlternatives(t *testing.T) {
+	tests := []struct {
+		name         string
+		security     string
+		operation    string
+		alternatives [][]string
+	}{
+		{
+			name:         "operation requirement",
+			operation:    `[{oauth: [write:pets, read:pets]}]`,
+			alternatives: [][]string{{"read:pets", "write:pets"}},
+		},
+		{
+			name:         "document requirement",
+			security:     `[{oauth: [read:pets]}]`,
+			alternatives: [][]string{{"read:pets"}},
+		},
+		{
+			name:         "operation overrides the document",
+			security:     `[{oauth: [read:pets]}]`,
+			operation:    `[{oauth: [admin]}]`,
+			alternatives: [][]string{{"admin"}},
+		},
+		{
+			name:         "alternatives keep their order",
+			operation:    `[{oauth: [write:pets]}, {oauth: [admin]}]`,
+			alternatives: [][]string{{"write:pets"}, {"admin"}},
+		},
+		{
+			name:         "schemes of a requirement are merged",
+			operation:    `[{oauth: [read:pets, write:pets], key: [read:pets, audit]}]`,
+			alternatives: [][]string{{"audit", "read:pets", "write:pets"}},
+		},
+		{
+			name:      "optional security",
+			operation: `[{oauth: [read:pets]}, {}]`,
+		},
+		{
+			name:      "alternative without scopes",
+			operation: `[{oauth: [read:pets]}, {key: []}]`,
+		},
+		{
+			name:      "security removed by the operation",
+			security:  `[{oauth: [read:pets]}]`,
+			operation: `[]`,
+		},
+		{
+			name: "no security",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := "openapi: 3.0.0\ninfo: {title: scopes, version: \"1\"}\n"
+			if test.security != "" {
+				spec += "security: " + test.security + "\n"
+			}
+			spec += "paths:\n  /pets:\n    get:\n      responses: {\"200\": {description: ok}}\n"
+			if test.operation != "" {
+				spec += "      security: " + test.operation + "\n"
+			}
+			swagger := loadTestSpec(t, spec)
+
+			alternatives := scopeAlternatives(swagger, swagger.Paths["/pets"].Get)
+			if len(alternatives) == 0 && len(test.alternatives) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(alternatives, test.alternatives) {
+				t.Errorf("got %q, want %q", alternatives, test.alternatives)
+			}
+		})
+	}
+}
+
+func TestBooleanFilterScopes(t *testing.T) {
+	swagger := loadTestSpec(t, `
+openapi: 3.0.0
+info: {title: scopes, version: "1"}
+paths:
+  /pets/{petId}:
+    get:
+      parameters: [{name: petId, in: path, required: true, schema: {type: string}}]
+      security: [{oauth: [read:pets]}, {oauth: [admin]}]
+      x-security-rego-boolean-filter:
+        - rules: [{operations: [{eq: [$petId, token.payload.petId]}]}]
+        - rules: [{operations: [{eq: [$petId, token.payload.petId]}]}]
+          ignore_scopes: true
+      responses: {"200": {description: ok}}
+`)
+
+	policy, err := GenerateWithOptions(swagger, Options{PackageName: DefaultPackageName})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	expected := []string{
+		"allow if {\n  input.path = [\"pets\", petId]\n  input.method = \"GET\"\n  token.payload.scopes[\"read:pets\"]\n  petId = token.payload.petId\n}",
+		"allow if {\n  input.path = [\"pets\", petId]\n  input.method = \"GET\"\n  token.payload.scopes[\"admin\"]\n  petId = token.payload.petId\n}",
+		"allow if {\n  input.path = [\"pets\", petId]\n  input.method = \"GET\"\n  petId = token.payload.petId\n}",
+	}
+	for _, rule := range expected {
+		if !strings.Contains(policy, rule) {
+			t.Errorf("policy does not contain the rule\n%v\n\npolicy:\n%v", rule, policy)
+		}
+	}
+}
+
+func TestDecisionPolicy(t *testing.T) {
+	swagger := loadTestSpec(t, testPetstore)
+
+	for _, options := range []Options{
+		{Strategy: StrategyAllow},
+		{Strategy: StrategyDeny},
+		{Strategy: StrategyAuthenticated, RegoVersion: RegoV0},
+		{Strategy: StrategyDeny, Mode: ModeData},
+	} {
+		options.PackageName = DefaultPackageName
+		options.Decision = true
+		files, err := GenerateFiles(swagger, options)
+		if err != nil {
+			t.Fatalf("%+v: %v", options, err)
+		}
+
+		module := checkRegoFiles(t, files)[policyFileName]
+		if module == nil {
+			t.Fatalf("%+v: no %v generated", options, policyFileName)
+		}
+		rules := map[string]int{}
+		for _, rule := range module.Rules {
+			rules[rule.Name]++
+		}
+		for _, name := range []string{"decision", "reasons", "matched_rules", "operation_id", "allow"} {
+			if rules[name] == 0 {
+				t.Errorf("%+v: the policy does not define %v", options, name)
+			}
+		}
+		if rules["decision"] != 1 {
+			t.Errorf("%+v: decision is defined %v times", options, rules["decision"])
+		}
+	}
+
+	// OPA rejects reading the keys of the empty matched_rules of a policy denying
+	// every operation
+	denied := loadTestSpec(t, `
+openapi: 3.0.0
+info: {title: denied, version: "1"}
+paths:
+  /pets:
+    get:
+      responses: {"200": {description: ok}}
+`)
+	policy, err := GenerateWithOptions(denied, Options{PackageName: DefaultPackageName, Decision: true, Strategy: StrategyDeny})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if strings.Contains(policy, "matched_rules[id]") {
+		t.Errorf("the policy reads the keys of the empty matched_rules\n%v", policy)
+	}
+}
@@ -0,0 +1,182 @@
+package opa
+
+import (
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Generator generates Rego policies from OpenAPI 3 specs. It is configured with
+// functional options and can be used to generate several policies.
+type Generator struct {
+	options Options
+}
+
+// Option configures a Generator
+type Option func(*Options)
+
+// Result is the outcome of generating the Rego policy of an OpenAPI 3 spec
+type Result struct {
+	// Files are the generated files, ie. the Rego policies and the data
+	Files []File
+
+	// Warnings are the problems found in the spec which do not prevent
+	// generating the policy, see Lint
+	Warnings []Problem
+
+	// Rules index the generated allow rules
+	Rules []IndexedRule
+
+	// ResourceSchema is the JSON Schema of the layout of the resource data the policy
+	// reads, nil if it reads none. It is not part of the policy but describes the data
+	// to push into OPA next to it.
+	ResourceSchema []byte
+}
+
+// IndexedRule defines a generated allow rule by its ID, the operation it allows
+// and the file it is generated into. The ID is the JSON pointer to the location
+// in the spec the rule originates from.
+type IndexedRule struct {
+	ID          string `json:"id"`
+	OperationID string `json:"operation_id"`
+	Path        string `json:"path"`
+	Method      string `json:"method"`
+	File        string `json:"file"`
+}
+
+// NewGenerator returns a Generator configured with the options. The policy is
+// generated in the DefaultPackageName package if not configured.
+func NewGenerator(opts ...Option) *Generator {
+	g := &Generator{options: Options{PackageName: DefaultPackageName}}
+	for _, opt := range opts {
+		opt(&g.options)
+	}
+	return g
+}
+
+// WithPackageName sets the package of the generated policy
+func WithPackageName(packageName string) Option {
+	return func(o *Options) {
+		o.PackageName = packageName
+	}
+}
+
+// WithRegoVersion sets the syntax of the generated Rego, RegoV0 or RegoV1
+func WithRegoVersion(regoVersion string) Option {
+	return func(o *Options) {
+		o.RegoVersion = regoVersion
+	}
+}
+
+// WithInputFields sets the fields of the input document read by the policy.
+// Unset fields keep their default.
+func WithInputFields(fields InputFields) Option {
+	return func(o *Options) {
+		o.Input = fields
+	}
+}
+
+// WithInputMapping sets the fields of the input document read by the policy and
+// how the token is read, eg. one of the InputPresets
+func WithInputMapping(mapping InputMapping) Option {
+	return func(o *Options) {
+		o.Input = mapping.InputFields
+		o.TokenSource = mapping.TokenSource
+	}
+}
+
+// WithTarget sets the integration the policy is generated for, TargetOPA or TargetEnvoy.
+// TargetEnvoy also sets the input mapping of OPA-Envoy, use WithInputMapping after
+// it to read a different input.
+func WithTarget(target string) Option {
+	return func(o *Options) {
+		o.Target = target
+		if target == TargetEnvoy {
+			o.Input = envoyInput.InputFields
+			o.TokenSource = envoyInput.TokenSource
+		}
+	}
+}
+
+// WithStrategy sets how operations without a boolean filter are allowed, StrategyAllow,
+// StrategyAuthenticated or StrategyDeny
+func WithStrategy(strategy string) Option {
+	return func(o *Options) {
+		o.Strategy = strategy
+	}
+}
+
+// WithRolesClaim sets the claim of the token holding the roles of the user, relative
+// to the token payload, eg. "realm_access.roles"
+func WithRolesClaim(claim string) Option {
+	return func(o *Options) {
+		o.RolesClaim = claim
+	}
+}
+
+// WithResources sets the document below data holding the resource data read by the
+// data operands, eg. "inventory.resources"
+func WithResources(resources string) Option {
+	return func(o *Options) {
+		o.Resources = resources
+	}
+}
+
+// WithPermissions sets the operations each role is allowed, generated as data read
+// by the policy
+func WithPermissions(permissions *Permissions) Option {
+	return func(o *Options) {
+		o.Permissions = permissions
+	}
+}
+
+// WithTokenSource sets how the token is read from the input, TokenJWT, TokenBearer
+// or TokenPayload
+func WithTokenSource(source string) Option {
+	return func(o *Options) {
+		o.TokenSource = source
+	}
+}
+
+// WithLayout sets how the policy is split into packages and files, LayoutSingle,
+// LayoutTag or LayoutPath
+func WithLayout(layout string) Option {
+	return func(o *Options) {
+		o.Layout = layout
+	}
+}
+
+// WithDecision generates a "decision" object with the outcome and the reasons for it
+func WithDecision(decision bool) Option {
+	return func(o *Options) {
+		o.Decision = decision
+	}
+}
+
+// WithMode sets whether the spec is compiled into Rego rules, ModeRules, or into
+// data tables evaluated by a generic policy, ModeData
+func WithMode(mode string) Option {
+	return func(o *Options) {
+		o.Mode = mode
+	}
+}
+
+// Options returns the options the generator is configured with
+func (g *Generator) Options() Options {
+	return g.options
+}
+
+// Generate generates the Rego policy of the OpenAPI 3 spec. Errors in the spec
+// are returned as Errors.
+func (g *Generator) Generate(swagger *openapi3.Swagger) (*Result, error) {
+	result, err := generate(swagger, g.options)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Warnings = []Problem{}
+	for _, problem := range Lint(swagger) {
+		if problem.Severity == SeverityWarning {
+			result.Warnings = append(result.Warnings, problem)
+		}
+	}
+	return result, nil
+}
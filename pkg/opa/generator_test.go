@@ -0,0 +1,43 @@
+package opa
+
+import (
+	"testing"
+)
+
+func TestGeneratorWarnings(t *testing.T) {
+	swagger := loadTestSpec(t, `
+openapi: 3.0.0
+info: {title: warnings, version: "1"}
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      x-security-rego-boolean-filter:
+        - rules: [{operations: [{eq: [input.owner, token.payload.sub]}]}]
+          unknown: true
+      responses: {"200": {description: ok}}
+`)
+
+	errors := 0
+	for _, problem := range Lint(swagger) {
+		if problem.Severity == SeverityError {
+			errors++
+		}
+	}
+	if errors == 0 {
+		t.Fatalf("no error for the unknown key of the boolean filter")
+	}
+
+	result, err := NewGenerator().Generate(swagger)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(result.Warnings) == 0 {
+		t.Errorf("no warning for the operation without security requirements")
+	}
+	for _, problem := range result.Warnings {
+		if problem.Severity != SeverityWarning {
+			t.Errorf("warning %v has severity %v", problem, problem.Severity)
+		}
+	}
+}
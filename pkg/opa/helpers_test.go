@@ -0,0 +1,88 @@
+package opa
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/openapi-to-rego/pkg/rego"
+)
+
+// loadTestSpec loads an OpenAPI spec given as YAML
+func loadTestSpec(t *testing.T, spec string) *openapi3.Swagger {
+	t.Helper()
+	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData([]byte(spec))
+	if err != nil {
+		t.Fatalf("loading spec: %v", err)
+	}
+	return swagger
+}
+
+// checkRegoFiles parses the Rego files and reports the errors found by the checker
+// and the rules defined by each file
+func checkRegoFiles(t *testing.T, files []File) map[string]*rego.Module {
+	t.Helper()
+	modules := map[string]*rego.Module{}
+	for _, file := range files {
+		if filepath.Ext(file.Name) != ".rego" {
+			continue
+		}
+		module, err := rego.Parse(file.Content)
+		if err != nil {
+			t.Errorf("%v: %v\n%v", file.Name, err, file.Content)
+			continue
+		}
+		for _, e := range rego.Check(module) {
+			t.Errorf("%v:%v\n%v", file.Name, e, file.Content)
+		}
+		modules[file.Name] = module
+	}
+	return modules
+}
+
+// testPetstore is a spec with a filter of every kind, a tag and path parameters
+const testPetstore = `
+openapi: 3.0.0
+info: {title: petstore, version: "1.0.0"}
+security: [{oauth: [read:pets]}]
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      tags: [pets]
+      security: [{oauth: [read:pets]}, {key: []}]
+      x-security-rego-field-filter:
+        - oauth: [ssn]
+      x-security-rego-list-filter:
+        - source: list
+          operations: [{eq: [owner, token.payload.username]}]
+      responses: {"200": {description: ok}}
+    post:
+      operationId: createPets
+      tags: [pets]
+      x-security-rego-overwrite-filter:
+        - field: enrolleeList
+          value: '"hidden"'
+          rules: [{operations: [{lt: [age, 18]}]}]
+      responses: {"200": {description: ok}}
+  /pets/{petId}:
+    get:
+      operationId: showPetById
+      tags: [pets]
+      x-security-rego-boolean-filter:
+        - rules:
+            - operations: [{eq: ['$petId', 'token.payload.pets[_].petId']}]
+            - operations: [{eq: [token.payload.role, '"admin"']}]
+      responses: {"200": {description: ok}}
+  /store/inventory:
+    get:
+      operationId: getInventory
+      tags: [store]
+      responses: {"200": {description: ok}}
+components:
+  securitySchemes:
+    oauth:
+      type: oauth2
+      flows: {implicit: {authorizationUrl: "https://example.com", scopes: {read:pets: read}}}
+    key: {type: apiKey, name: key, in: header}
+`
@@ -0,0 +1,785 @@
+package opa
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/openapi-to-rego/pkg/rego"
+)
+
+// helperRuleRE matches the names of the helper rules of the overwrite filters
+var helperRuleRE = regexp.MustCompile("^" + helperRuleName + "[0-9]+$")
+
+// importOperators maps the operators of Rego expressions to the operations of the extensions
+var importOperators = map[string]string{
+	"=":  "eq",
+	"==": "eq",
+	"<":  "lt",
+	">=": "gte",
+}
+
+// Annotation is an OpenAPI extension of an operation imported from a Rego policy
+type Annotation struct {
+	// Pointer is the JSON pointer to the operation in the spec
+	Pointer   string
+	Path      string
+	Method    string
+	Extension string
+	Value     interface{}
+}
+
+// ImportProblem is a rule of a Rego policy which could not be imported
+type ImportProblem struct {
+	Line    int    `json:"line"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ImportResult is the outcome of importing a Rego policy into a spec
+type ImportResult struct {
+	Annotations []Annotation
+	Problems    []ImportProblem
+}
+
+// importedOperation collects the rules imported for an operation
+type importedOperation struct {
+	security     map[string][]string
+	scopes       [][]string
+	allowRules   []rule
+	conditional  bool
+	fieldFilters []extensionDefinition
+	listFilters  []policySchemaListFilter
+
+	// unscopedRules are the allow rules which do not require the scopes of the
+	// operation, ruleScopes the alternative sets of scopes each allow rule was
+	// imported with by the rule
+	unscopedRules       []rule
+	unscopedConditional bool
+	ruleScopes          map[string]map[int]bool
+
+	// roles are the roles all allow rules require, nil if the rules require none
+	roles      []string
+	ruleCount  int
+	rolesCount int
+
+	// helpers holds the rules of the overwrite helper rules by name
+	helpers map[string][]rule
+}
+
+// importedOverwrite is an overwrite of a field of the response object read from the
+// rules of the "response" object
+type importedOverwrite struct {
+	Line    int
+	Value   interface{}
+	Negated bool
+	Helper  string
+}
+
+// Import reads a Rego policy whose rules follow the shape of the generated rules
+// and returns the x-security-rego extensions of the operations of the spec which
+// generate them. Rules are mapped to the operations by the path and the method
+// they match, read from the input fields of the options. The rules which cannot be
+// mapped or translated are returned as problems.
+func Import(swagger *openapi3.Swagger, policy string, options Options) (*ImportResult, error) {
+	module, err := rego.Parse(policy)
+	if err != nil {
+		return nil, err
+	}
+	claim, err := rolesClaim(options)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := resourcesRef(options)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions, _ := loadConditions(swagger)
+	tenant, _ := loadTenant(swagger)
+
+	i := &importer{
+		swagger:    swagger,
+		input:      options.Input.withDefaults(),
+		claim:      claim,
+		resources:  resources,
+		conditions: conditions,
+		tenant:     tenant,
+		operations: map[string]*importedOperation{},
+		overwrites: map[string]importedOverwrite{},
+		result:     &ImportResult{Annotations: []Annotation{}, Problems: []ImportProblem{}},
+	}
+	for _, r := range module.Rules {
+		i.importRule(r)
+	}
+	i.annotate()
+	return i.result, nil
+}
+
+// importer imports the rules of a Rego policy
+type importer struct {
+	swagger    *openapi3.Swagger
+	input      InputFields
+	claim      string
+	resources  string
+	conditions namedConditions
+	tenant     *tenantIsolation
+	operations map[string]*importedOperation
+	overwrites map[string]importedOverwrite
+	result     *ImportResult
+}
+
+func (i *importer) problem(r *rego.Rule, format string, args ...interface{}) {
+	i.result.Problems = append(i.result.Problems, ImportProblem{
+		Line:    r.Line,
+		Rule:    r.Name,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// importRule imports a rule by its name and kind
+func (i *importer) importRule(r *rego.Rule) {
+	switch {
+	case r.Default || r.Name == "token" || r.Name == requestPathRuleName:
+		// generated for every policy
+	case r.Name == "user_roles" || r.Name == permittedOp:
+		// generated for the permissions, which are not part of the spec
+	case i.isConditionHelper(r.Name):
+		// generated for the named conditions of the components, which are referenced
+	case r.Name == "allow" && r.Kind() == "complete" && isTrue(r.Value):
+		i.importAllow(r)
+	case r.Name == "filter" && r.Kind() == "complete":
+		i.importFieldFilter(r)
+	case r.Name == "list_filter" && r.Kind() == "set":
+		i.importListFilter(r)
+	case r.Name == "response" && r.Kind() == "object":
+		i.importResponse(r)
+	case helperRuleRE.MatchString(r.Name) && r.Kind() == "complete" && isTrue(r.Value):
+		i.importHelper(r)
+	default:
+		i.problem(r, "%v rule %v does not have the shape of a generated rule", r.Kind(), r.Name)
+	}
+}
+
+// conditionHelper returns the named condition of the spec whose helper rule for the
+// extension has the name
+func (i *importer) conditionHelper(name string, extension string) (string, bool) {
+	prefix := conditionRulePrefixes[extension]
+	if !strings.HasPrefix(name, prefix) {
+		return "", false
+	}
+	_, ok := i.conditions[strings.TrimPrefix(name, prefix)]
+	return strings.TrimPrefix(name, prefix), ok
+}
+
+// isConditionHelper returns whether the rule is the helper rule of a named condition
+func (i *importer) isConditionHelper(name string) bool {
+	for extension := range conditionRulePrefixes {
+		if _, ok := i.conditionHelper(name, extension); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOperation returns the operation whose path and method the body matches, the
+// names of the path parameters by var and the other expressions of the body
+func (i *importer) matchOperation(r *rego.Rule) (*importedOperation, map[string]string, []*rego.Expr, bool) {
+	pathRef, _ := i.input.ref("path")
+	methodRef, _ := i.input.ref("method")
+
+	var path, method *rego.Term
+	rest := []*rego.Expr{}
+	for _, expr := range r.Body {
+		if term := matchedTerm(expr, pathRef); term != nil && term.Kind == rego.ArrayTerm && path == nil {
+			path = term
+		} else if term := matchedTerm(expr, methodRef); term != nil && term.Kind == rego.StringTerm && method == nil {
+			method = term
+		} else {
+			rest = append(rest, expr)
+		}
+	}
+	if path == nil || method == nil {
+		i.problem(r, "rule does not match the path and the method of an operation")
+		return nil, nil, nil, false
+	}
+
+	methodName, _ := strconv.Unquote(method.Value)
+	for _, o := range sortedOperations(i.swagger) {
+		if o.Method != strings.ToUpper(methodName) {
+			continue
+		}
+		if params, ok := matchPath(o.Path, path); ok {
+			key := specPointer("paths", o.Path, strings.ToLower(o.Method))
+			if _, ok := i.operations[key]; !ok {
+				security := map[string][]string{}
+				if o.Operation.Security != nil {
+					security = getSecuritySchemes(o.Operation.Security)
+				}
+				i.operations[key] = &importedOperation{
+					security:   security,
+					scopes:     scopeAlternatives(i.swagger, o.Operation),
+					ruleScopes: map[string]map[int]bool{},
+					helpers:    map[string][]rule{},
+				}
+			}
+			return i.operations[key], params, rest, true
+		}
+	}
+	i.problem(r, "no operation of the spec matches %v %v", methodName, path)
+	return nil, nil, nil, false
+}
+
+// importAllow imports an allow rule, the expressions besides the path, the
+// method and the scopes are a rule of a boolean filter. Rules are generated for
+// every alternative set of scopes of the operation, the rule is imported once.
+func (i *importer) importAllow(r *rego.Rule) {
+	o, params, rest, ok := i.matchOperation(r)
+	if !ok {
+		return
+	}
+
+	scopes := []string{}
+	exprs := []*rego.Expr{}
+	var roles []string
+	for _, expr := range rest {
+		if scope, ok := scopeOf(expr); ok {
+			scopes = append(scopes, scope)
+		} else if isPermitted(expr) || i.isTenantCheck(expr) {
+			// the permissions and the tenant check are generated for every operation
+		} else if r, claim, ok := rolesOfExpression(expr.String()); ok && claim == i.claim && roles == nil {
+			roles = r
+		} else {
+			exprs = append(exprs, expr)
+		}
+	}
+
+	// the roles extension applies to all the rules of the operation
+	o.ruleCount++
+	if roles != nil {
+		if o.roles != nil && (len(missing(roles, o.roles)) > 0 || len(missing(o.roles, roles)) > 0) {
+			i.problem(r, "rule requires the roles %v instead of the roles %v of the other rules of the operation", strings.Join(roles, ", "), strings.Join(o.roles, ", "))
+			return
+		}
+		o.roles = roles
+		o.rolesCount++
+	}
+
+	operations, ok := i.translate(r, exprs, func(t *rego.Term) (interface{}, bool) {
+		if value, ok := resourceOperand(t, params, i.resources); ok {
+			return value, true
+		}
+		return booleanOperand(t, params), true
+	}, oasSecExtRegoBooleanFilter)
+	if !ok {
+		return
+	}
+
+	if len(o.scopes) == 0 || len(scopes) == 0 {
+		if len(scopes) > 0 {
+			i.problem(r, "operation does not require the scopes %v", strings.Join(scopes, ", "))
+			return
+		}
+		if len(o.scopes) > 0 {
+			o.unscopedRules = append(o.unscopedRules, rule{Operations: operations})
+			o.unscopedConditional = o.unscopedConditional || len(operations) > 0
+			return
+		}
+		o.allowRules = append(o.allowRules, rule{Operations: operations})
+		o.conditional = o.conditional || len(operations) > 0
+		return
+	}
+
+	alternative := -1
+	for n, required := range o.scopes {
+		if len(missing(required, scopes)) == 0 && len(missing(scopes, required)) == 0 {
+			alternative = n
+		}
+	}
+	if alternative < 0 {
+		i.problem(r, "no security requirement of the operation requires the scopes %v", strings.Join(scopes, ", "))
+		return
+	}
+
+	key := fmt.Sprint(operations)
+	if _, ok := o.ruleScopes[key]; !ok {
+		o.ruleScopes[key] = map[int]bool{}
+		o.allowRules = append(o.allowRules, rule{Operations: operations})
+		o.conditional = true
+	}
+	o.ruleScopes[key][alternative] = true
+}
+
+// importFieldFilter imports a filter rule, the scopes it requires identify the
+// security scheme of the operation
+func (i *importer) importFieldFilter(r *rego.Rule) {
+	if r.Value == nil || r.Value.Kind != rego.ArrayTerm {
+		i.problem(r, "filter is not an array of fields")
+		return
+	}
+	fields := []string{}
+	for _, item := range r.Value.Items {
+		field, err := strconv.Unquote(item.Value)
+		if item.Kind != rego.StringTerm || err != nil {
+			i.problem(r, "filter field %v is not a string", item)
+			return
+		}
+		fields = append(fields, field)
+	}
+
+	o, _, rest, ok := i.matchOperation(r)
+	if !ok {
+		return
+	}
+
+	scopes := []string{}
+	for _, expr := range rest {
+		scope, ok := scopeOf(expr)
+		if !ok {
+			i.problem(r, "expression %v of a filter is not a required scope", expr)
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+
+	scheme, ok := o.schemeWithScopes(scopes)
+	if !ok {
+		i.problem(r, "no security scheme of the operation requires the scopes %v", strings.Join(scopes, ", "))
+		return
+	}
+	o.fieldFilters = append(o.fieldFilters, extensionDefinition{scheme: fields})
+}
+
+// importListFilter imports a list_filter rule, the list is read from the input
+// into x
+func (i *importer) importListFilter(r *rego.Rule) {
+	if r.Key.Kind != rego.VarTerm || r.Key.Value != "x" {
+		i.problem(r, "list_filter does not contain x")
+		return
+	}
+
+	o, params, rest, ok := i.matchOperation(r)
+	if !ok {
+		return
+	}
+
+	source := ""
+	exprs := []*rego.Expr{}
+	for _, expr := range rest {
+		if s, ok := listSource(expr); ok && source == "" {
+			source = s
+			continue
+		}
+		exprs = append(exprs, expr)
+	}
+	if source == "" {
+		i.problem(r, "list_filter does not read x from a list in the input")
+		return
+	}
+
+	operations, ok := i.translate(r, exprs, func(t *rego.Term) (interface{}, bool) {
+		if value, ok := resourceOperand(t, params, i.resources); ok {
+			return value, true
+		}
+		return listOperand(t, params)
+	}, oasSecExtRegoListFilter)
+	if !ok {
+		return
+	}
+	o.listFilters = append(o.listFilters, policySchemaListFilter{Source: source, Operations: operations})
+}
+
+// importResponse imports a rule of the response object, the rule assigning a value
+// other than the field of the input object is the overwrite of the field
+func (i *importer) importResponse(r *rego.Rule) {
+	field, err := strconv.Unquote(r.Key.Value)
+	if r.Key.Kind != rego.StringTerm || err != nil {
+		i.problem(r, "response key %v is not a field", r.Key)
+		return
+	}
+
+	if len(r.Body) != 1 || r.Body[0].Op != "" || r.Body[0].Some != nil || r.Body[0].Terms[0].Kind != rego.VarTerm {
+		i.problem(r, "response field %v does not depend on a helper rule", field)
+		return
+	}
+	helper := r.Body[0].Terms[0].Value
+
+	objectRef, _ := i.input.ref("object")
+	if r.Value.String() == objectRef+"."+field {
+		return
+	}
+
+	if _, ok := i.overwrites[field]; ok {
+		i.problem(r, "response field %v is overwritten twice", field)
+		return
+	}
+	i.overwrites[field] = importedOverwrite{
+		Line:    r.Line,
+		Value:   overwriteValue(r.Value),
+		Negated: r.Body[0].Negated,
+		Helper:  helper,
+	}
+}
+
+// importHelper imports a helper rule of an overwrite filter, its expressions besides
+// the path and the method are a rule of the overwrite filter
+func (i *importer) importHelper(r *rego.Rule) {
+	o, params, rest, ok := i.matchOperation(r)
+	if !ok {
+		return
+	}
+
+	objectRef, _ := i.input.ref("object")
+	operations, ok := i.translate(r, rest, func(t *rego.Term) (interface{}, bool) {
+		if value, ok := resourceOperand(t, params, i.resources); ok {
+			return value, true
+		}
+		return overwriteOperand(t, params, objectRef)
+	}, oasSecExtRegoOverwriteFilter)
+	if !ok {
+		return
+	}
+	o.helpers[r.Name] = append(o.helpers[r.Name], rule{Operations: operations})
+}
+
+// translate translates the expressions into the operations of an extension with
+// the operand function. Negations are only supported by boolean filters, calls of
+// the helper rules of the named conditions are translated into references.
+func (i *importer) translate(r *rego.Rule, exprs []*rego.Expr, operand func(*rego.Term) (interface{}, bool), extension string) ([]operation, bool) {
+	negation := extension == oasSecExtRegoBooleanFilter
+	operations := []operation{}
+	for _, expr := range exprs {
+		var op string
+		var terms []*rego.Term
+		switch {
+		case expr.Some != nil:
+		case expr.Op == "" && !expr.Negated && (expr.Terms[0].Kind == rego.CallTerm || expr.Terms[0].Kind == rego.VarTerm):
+			if name, ok := i.conditionHelper(expr.Terms[0].Value, extension); ok {
+				operations = append(operations, operation{refOp: []interface{}{conditionRefPrefix + name}})
+				continue
+			}
+		case expr.Negated && expr.Op == "" && negation:
+			op, terms = "negation", expr.Terms
+		case !expr.Negated && expr.Op != "":
+			op, terms = importOperators[expr.Op], expr.Terms
+		}
+		if op == "" {
+			i.problem(r, "expression %v cannot be translated into an operation", expr)
+			return nil, false
+		}
+
+		operands := []interface{}{}
+		for _, term := range terms {
+			value, ok := operand(term)
+			if !ok {
+				i.problem(r, "operand %v of expression %v cannot be translated", term, expr)
+				return nil, false
+			}
+			operands = append(operands, value)
+		}
+		operations = append(operations, operation{op: operands})
+	}
+	return operations, true
+}
+
+// annotate adds the annotations of the imported rules in the order of the operations
+func (i *importer) annotate() {
+	for _, ref := range sortedOperations(i.swagger) {
+		pointer := []interface{}{"paths", ref.Path, strings.ToLower(ref.Method)}
+		o, ok := i.operations[specPointer(pointer...)]
+		if !ok || len(o.allowRules) == 0 && len(o.unscopedRules) == 0 {
+			// the generated policy allows every operation without a boolean filter
+			i.result.Problems = append(i.result.Problems, ImportProblem{
+				Message: fmt.Sprintf("operation %v %v is not allowed by any imported rule, the generated policy allows it", ref.Method, ref.Path),
+			})
+		}
+		if !ok {
+			continue
+		}
+
+		add := func(extension string, value interface{}) {
+			if inherited, ok := ref.Inherited[extension]; ok {
+				message := fmt.Sprintf("operation %v %v already has the extension %v", ref.Method, ref.Path, extension)
+				if levels := inherited.Levels; levels[len(levels)-1] != levelOperation {
+					message = fmt.Sprintf("operation %v %v already inherits the extension %v from the %v", ref.Method, ref.Path, extension, levels[len(levels)-1])
+				}
+				i.result.Problems = append(i.result.Problems, ImportProblem{Message: message})
+				return
+			}
+			i.result.Annotations = append(i.result.Annotations, Annotation{
+				Pointer:   specPointer(pointer...),
+				Path:      ref.Path,
+				Method:    ref.Method,
+				Extension: extension,
+				Value:     value,
+			})
+		}
+
+		if len(o.fieldFilters) > 0 {
+			add(oasSecExtRegoFieldFilter, o.fieldFilters)
+		}
+		if len(o.listFilters) > 0 {
+			add(oasSecExtRegoListFilter, o.listFilters)
+		}
+
+		overwrites := []policySchemaOverwriteFilter{}
+		for _, field := range sortedKeys(i.overwrites) {
+			overwrite := i.overwrites[field]
+			if rules, ok := o.helpers[overwrite.Helper]; ok {
+				overwrites = append(overwrites, policySchemaOverwriteFilter{
+					Field:   field,
+					Value:   overwrite.Value,
+					Negated: overwrite.Negated,
+					Rules:   rules,
+				})
+			}
+		}
+		if len(overwrites) > 0 {
+			add(oasSecExtRegoOverwriteFilter, overwrites)
+		}
+
+		if o.roles != nil {
+			if o.rolesCount < o.ruleCount {
+				i.result.Problems = append(i.result.Problems, ImportProblem{
+					Message: fmt.Sprintf("not every rule of operation %v %v requires the roles %v, the generated policy requires them for all", ref.Method, ref.Path, strings.Join(o.roles, ", ")),
+				})
+			}
+			add(oasSecExtRegoRoles, o.roles)
+		}
+
+		// rules generated for some of the alternative sets of scopes only are
+		// generated for all of them
+		for _, key := range sortedKeys(o.ruleScopes) {
+			if len(o.ruleScopes[key]) < len(o.scopes) {
+				i.result.Problems = append(i.result.Problems, ImportProblem{
+					Message: fmt.Sprintf("rule %v of operation %v %v does not require every alternative set of scopes, the generated policy allows any of them", key, ref.Method, ref.Path),
+				})
+			}
+		}
+
+		// an operation allowed by a rule without conditions only needs a boolean
+		// filter if it has conditional rules as well
+		filters := []policySchemaBooleanFilter{}
+		if o.conditional {
+			filters = append(filters, policySchemaBooleanFilter{Rules: o.allowRules})
+		}
+		if o.unscopedConditional || len(o.unscopedRules) > 0 && len(filters) > 0 {
+			filters = append(filters, policySchemaBooleanFilter{Rules: o.unscopedRules, IgnoreScopes: true})
+		}
+		if len(filters) > 0 {
+			add(oasSecExtRegoBooleanFilter, filters)
+		}
+	}
+}
+
+// schemeWithScopes returns the security scheme of the operation which requires the scopes
+func (o *importedOperation) schemeWithScopes(scopes []string) (string, bool) {
+	for _, scheme := range sortedKeys(o.security) {
+		required := o.security[scheme]
+		if len(missing(required, scopes)) == 0 && len(missing(scopes, required)) == 0 {
+			return scheme, true
+		}
+	}
+	return "", false
+}
+
+// matchedTerm returns the term the expression matches against the ref, if any
+func matchedTerm(expr *rego.Expr, ref string) *rego.Term {
+	if expr.Negated || expr.Op != "=" && expr.Op != "==" {
+		return nil
+	}
+	if expr.Terms[0].String() == ref {
+		return expr.Terms[1]
+	}
+	if expr.Terms[1].String() == ref {
+		return expr.Terms[0]
+	}
+	return nil
+}
+
+// matchPath returns whether the path array matches the path of the OpenAPI spec and
+// the names of the path parameters by the vars of the array
+func matchPath(specPath string, path *rego.Term) (map[string]string, bool) {
+	segments := pathSegments(specPath)
+	if len(segments) != len(path.Items) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for n, item := range path.Items {
+		match := pathParamRE.FindStringSubmatch(segments[n])
+		switch {
+		case match != nil && match[0] == segments[n] && item.Kind == rego.VarTerm:
+			params[item.Value] = match[1]
+		case item.Kind == rego.StringTerm && item.Value == strconv.Quote(segments[n]):
+		default:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// scopeOf returns the scope the expression requires from the token
+func scopeOf(expr *rego.Expr) (string, bool) {
+	if expr.Negated || expr.Op != "" || expr.Some != nil {
+		return "", false
+	}
+	term := expr.Terms[0]
+	if term.Kind != rego.RefTerm || len(term.Items) != 4 || (&rego.Term{Kind: rego.RefTerm, Items: term.Items[:3]}).String() != tokenPrefix+".payload.scopes" {
+		return "", false
+	}
+	scope, err := strconv.Unquote(term.Items[3].Value)
+	return scope, err == nil && term.Items[3].Kind == rego.StringTerm && !term.Items[3].Dot
+}
+
+// isPermitted returns whether the expression checks the permissions of the roles of the user
+func isPermitted(expr *rego.Expr) bool {
+	if expr.Negated || expr.Op != "" || expr.Some != nil {
+		return false
+	}
+	term := expr.Terms[0]
+	return term.Kind == rego.CallTerm && term.Value == permittedOp && len(term.Items) == 2 && term.Items[0].String() == "user_roles"
+}
+
+// isTenantCheck returns whether the expression is the tenant check of the document
+func (i *importer) isTenantCheck(expr *rego.Expr) bool {
+	if i.tenant == nil {
+		return false
+	}
+	for n := range i.tenant.Sources {
+		if expr.String() == i.tenant.expression(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// listSource returns the source of the list the expression reads x from, ie.
+// "list" for "x := input.list[_]"
+func listSource(expr *rego.Expr) (string, bool) {
+	if expr.Negated || expr.Op != ":=" || expr.Terms[0].Kind != rego.VarTerm || expr.Terms[0].Value != "x" {
+		return "", false
+	}
+	ref := expr.Terms[1].String()
+	prefix, suffix := inputPrefix+".", "[_]"
+	if !strings.HasPrefix(ref, prefix) || !strings.HasSuffix(ref, suffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(ref, prefix), suffix), true
+}
+
+// booleanOperand translates a term of a boolean filter expression, which is
+// generated as is, except for the path parameters
+func booleanOperand(t *rego.Term, params map[string]string) interface{} {
+	if value, ok := scalarOperand(t, params); ok {
+		return value
+	}
+	return t.String()
+}
+
+// listOperand translates a term of a list filter expression. Fields of x are
+// given without the x, refs to the token and the input as is.
+func listOperand(t *rego.Term, params map[string]string) (interface{}, bool) {
+	if value, ok := scalarOperand(t, params); ok {
+		return value, t.Kind != rego.StringTerm
+	}
+	ref := t.String()
+	switch {
+	case strings.HasPrefix(ref, "x."):
+		return strings.TrimPrefix(ref, "x."), true
+	case strings.HasPrefix(ref, tokenPrefix) || strings.HasPrefix(ref, inputPrefix):
+		return ref, true
+	}
+	return nil, false
+}
+
+// overwriteOperand translates a term of an overwrite filter expression. Fields of
+// the input object are given without the object, refs to the token and strings as is.
+func overwriteOperand(t *rego.Term, params map[string]string, objectRef string) (interface{}, bool) {
+	if value, ok := scalarOperand(t, params); ok {
+		return value, true
+	}
+	ref := t.String()
+	switch {
+	case strings.HasPrefix(ref, objectRef+"."):
+		return strings.TrimPrefix(ref, objectRef+"."), true
+	case strings.HasPrefix(ref, tokenPrefix):
+		return ref, true
+	}
+	return nil, false
+}
+
+// resourceOperand translates a ref into the resource data into a data operand. Vars
+// of the ref are path parameters or wildcards.
+func resourceOperand(t *rego.Term, params map[string]string, resources string) (interface{}, bool) {
+	n := strings.Count(resources, ".") + 1
+	if t.Kind != rego.RefTerm || len(t.Items) <= n || !t.Items[n].Dot {
+		return nil, false
+	}
+	if (&rego.Term{Kind: rego.RefTerm, Items: t.Items[:n]}).String() != resources {
+		return nil, false
+	}
+
+	ref := strings.Trim(t.Items[n].Value, "\"")
+	for _, item := range t.Items[n+1:] {
+		switch {
+		case item.Dot:
+			ref += "." + strings.Trim(item.Value, "\"")
+		case item.Kind == rego.VarTerm && item.Value == "_":
+			ref += "[_]"
+		case item.Kind == rego.VarTerm:
+			param, ok := params[item.Value]
+			if !ok {
+				return nil, false
+			}
+			ref += fmt.Sprintf("[%v%v]", pathTemplatePrefix, param)
+		case item.Kind == rego.StringTerm || item.Kind == rego.NumberTerm:
+			ref += "[" + item.Value + "]"
+		default:
+			return nil, false
+		}
+	}
+	return map[string]interface{}{dataOperandKey: ref}, true
+}
+
+// scalarOperand translates path parameters, booleans, numbers and strings
+func scalarOperand(t *rego.Term, params map[string]string) (interface{}, bool) {
+	switch t.Kind {
+	case rego.VarTerm:
+		if param, ok := params[t.Value]; ok {
+			return pathTemplatePrefix + param, true
+		}
+	case rego.BooleanTerm:
+		return t.Value == "true", true
+	case rego.NumberTerm:
+		if n, err := strconv.ParseFloat(t.Value, 64); err == nil {
+			return n, true
+		}
+	case rego.StringTerm:
+		return t.Value, true
+	}
+	return nil, false
+}
+
+// overwriteValue returns the value of an overwrite, nil for null
+func overwriteValue(t *rego.Term) interface{} {
+	switch t.Kind {
+	case rego.NullTerm:
+		return nil
+	case rego.BooleanTerm:
+		return t.Value == "true"
+	case rego.NumberTerm:
+		if n, err := strconv.ParseFloat(t.Value, 64); err == nil {
+			return n
+		}
+	}
+	return t.String()
+}
+
+// isTrue returns whether the value of a rule is true, which is the value of a
+// rule without one
+func isTrue(t *rego.Term) bool {
+	return t == nil || t.Kind == rego.BooleanTerm && t.Value == "true"
+}
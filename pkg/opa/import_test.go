@@ -0,0 +1,73 @@
+package opa
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openapi-to-rego/pkg/util"
+)
+
+func TestImportRoundTrip(t *testing.T) {
+	tests := []struct {
+		spec    string
+		options []Option
+	}{
+		{spec: "petstore-rego-field-filter.yaml"},
+		{spec: "petstore-rego-list-filter.yaml"},
+		{spec: "petstore-rego-overwrite-filter.yaml"},
+		{spec: "petstore-rego-boolean-filter.yaml"},
+		{spec: "petstore-rego-list-filter.yaml", options: []Option{WithRegoVersion(RegoV0)}},
+		{spec: "petstore-rego-boolean-filter.yaml", options: []Option{WithInputFields(InputPresets[PresetHTTP].InputFields)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			swagger, err := util.LoadSwagger("../../examples/" + test.spec)
+			if err != nil {
+				t.Fatalf("LoadSwagger: %v", err)
+			}
+			generator := NewGenerator(test.options...)
+			result, err := generator.Generate(swagger)
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+
+			// the operations of the spec without their extensions are annotated
+			// from the generated policy and generate it again
+			for _, o := range sortedOperations(swagger) {
+				operation := swagger.Paths[o.Path].GetOperation(strings.ToUpper(o.Method))
+				for name := range operation.Extensions {
+					if _, ok := extensionTypes[name]; ok {
+						delete(operation.Extensions, name)
+					}
+				}
+			}
+
+			imported, err := Import(swagger, result.Files[0].Content, generator.Options())
+			if err != nil {
+				t.Fatalf("Import: %v", err)
+			}
+			if len(imported.Annotations) == 0 {
+				t.Fatalf("no annotations imported, problems %v", imported.Problems)
+			}
+			for _, annotation := range imported.Annotations {
+				value, err := json.Marshal(annotation.Value)
+				if err != nil {
+					t.Fatalf("annotation %v: %v", annotation.Pointer, err)
+				}
+				operation := swagger.Paths[annotation.Path].GetOperation(strings.ToUpper(annotation.Method))
+				operation.Extensions[annotation.Extension] = json.RawMessage(value)
+			}
+
+			regenerated, err := generator.Generate(swagger)
+			if err != nil {
+				t.Fatalf("Generate imported spec: %v", err)
+			}
+			if !reflect.DeepEqual(regenerated.Files, result.Files) {
+				t.Errorf("got policy\n%v\nwant\n%v\nimport problems %v", regenerated.Files, result.Files, imported.Problems)
+			}
+		})
+	}
+}
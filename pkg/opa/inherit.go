@@ -0,0 +1,194 @@
+package opa
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const (
+	// OAS Extension listing the extensions of an object whose values are appended to
+	// the inherited values instead of replacing them
+	oasSecExtRegoMerge = "x-security-rego-merge"
+
+	// tagsField is the field of the document holding the tag objects. The OpenAPI
+	// package keeps it among the extensions of the document.
+	tagsField = "tags"
+)
+
+// Levels of the spec the extensions of an operation are inherited from, from the
+// least specific
+const (
+	levelDocument  = "document"
+	levelTag       = "tag"
+	levelPath      = "path"
+	levelOperation = "operation"
+)
+
+// extensionLevel is an object of the spec defining extensions for the operations below it
+type extensionLevel struct {
+	Name       string
+	Pointer    []interface{}
+	Extensions map[string]interface{}
+}
+
+// inheritedExtension records where the effective value of an extension of an
+// operation is defined
+type inheritedExtension struct {
+	// Levels are the levels the value is taken from, from the least specific
+	Levels []string
+
+	// Pointer locates the value at the most specific level
+	Pointer []interface{}
+
+	// Items locate each item of a list value, which may be merged from several levels
+	Items [][]interface{}
+}
+
+// extensionLevels returns the objects of the spec the operation inherits extensions
+// from: the document, the tags of the operation, the path item and the operation.
+// The first tag listed by the operation takes precedence over the others.
+func extensionLevels(swagger *openapi3.Swagger, path string, method string, operation *openapi3.Operation) []extensionLevel {
+	levels := []extensionLevel{{Name: levelDocument, Extensions: swagger.Extensions}}
+
+	tags := tagExtensions(swagger)
+	for i := len(operation.Tags) - 1; i >= 0; i-- {
+		for index, tag := range tags {
+			if tag.Name == operation.Tags[i] {
+				levels = append(levels, extensionLevel{
+					Name:       fmt.Sprintf("%v %v", levelTag, tag.Name),
+					Pointer:    []interface{}{tagsField, index},
+					Extensions: tag.Extensions,
+				})
+			}
+		}
+	}
+
+	pathItem := swagger.Paths[path]
+	return append(levels, extensionLevel{
+		Name:       levelPath,
+		Pointer:    []interface{}{"paths", path},
+		Extensions: pathItem.Extensions,
+	}, extensionLevel{
+		Name:       levelOperation,
+		Pointer:    []interface{}{"paths", path, strings.ToLower(method)},
+		Extensions: operation.Extensions,
+	})
+}
+
+// tagObject is a tag object of the document with its extensions
+type tagObject struct {
+	Name       string
+	Extensions map[string]interface{}
+}
+
+// tagExtensions returns the tag objects of the document in their order. Tags which
+// cannot be decoded have no extensions.
+func tagExtensions(swagger *openapi3.Swagger) []tagObject {
+	var raw []map[string]json.RawMessage
+	if data, ok := swagger.Extensions[tagsField].(json.RawMessage); !ok || json.Unmarshal(data, &raw) != nil {
+		return nil
+	}
+
+	tags := make([]tagObject, len(raw))
+	for i, fields := range raw {
+		tags[i].Extensions = map[string]interface{}{}
+		for key, value := range fields {
+			if key == "name" {
+				json.Unmarshal(value, &tags[i].Name)
+			} else if strings.HasPrefix(key, "x-") {
+				tags[i].Extensions[key] = value
+			}
+		}
+	}
+	return tags
+}
+
+// inheritExtensions returns the effective extensions of an operation and where they
+// are defined. An extension defined by a level replaces the value it inherits from
+// the less specific levels, unless the level lists it in the merge extension: the
+// items of a list value are then appended to the inherited items.
+func inheritExtensions(levels []extensionLevel) (map[string]interface{}, map[string]*inheritedExtension) {
+	operation := levels[len(levels)-1]
+	extensions := map[string]interface{}{}
+	for name, value := range operation.Extensions {
+		extensions[name] = value
+	}
+	inherited := map[string]*inheritedExtension{}
+
+	for _, level := range levels {
+		var merged []string
+		if val, ok := level.Extensions[oasSecExtRegoMerge]; ok {
+			unmarshalExtension(val, &merged)
+		}
+
+		for _, name := range sortedKeys(level.Extensions) {
+			t, ok := extensionTypes[name]
+			if !ok || name == oasSecExtRegoMerge {
+				continue
+			}
+			data, ok := level.Extensions[name].(json.RawMessage)
+			if !ok {
+				continue
+			}
+
+			pointer := pointerAt(level.Pointer, name)
+			var items []json.RawMessage
+			if t.Kind() != reflect.Slice || json.Unmarshal(data, &items) != nil {
+				items = nil
+			}
+			itemPointers := [][]interface{}{}
+			for i := range items {
+				itemPointers = append(itemPointers, pointerAt(pointer, i))
+			}
+
+			previous, ok := inherited[name]
+			if ok && items != nil && previous.Items != nil && len(missing([]string{name}, merged)) == 0 {
+				var values []json.RawMessage
+				json.Unmarshal(extensions[name].(json.RawMessage), &values)
+				value, err := json.Marshal(append(values, items...))
+				if err == nil {
+					extensions[name] = json.RawMessage(value)
+					previous.Levels = append(previous.Levels, level.Name)
+					previous.Pointer = pointer
+					previous.Items = append(previous.Items, itemPointers...)
+					continue
+				}
+			}
+
+			if items == nil {
+				itemPointers = nil
+			}
+			extensions[name] = data
+			inherited[name] = &inheritedExtension{
+				Levels:  []string{level.Name},
+				Pointer: pointer,
+				Items:   itemPointers,
+			}
+		}
+	}
+	return extensions, inherited
+}
+
+// extensionPointer returns a function locating the tokens below the effective value
+// of the extension where they are defined. The first token of the tokens below a list
+// value is the index of an item.
+func (o operationRef) extensionPointer(name string) func(tokens ...interface{}) []interface{} {
+	pointer := []interface{}{"paths", o.Path, strings.ToLower(o.Method), name}
+	inherited, ok := o.Inherited[name]
+	if ok {
+		pointer = inherited.Pointer
+	}
+
+	return func(tokens ...interface{}) []interface{} {
+		if ok && len(tokens) > 0 {
+			if i, isIndex := tokens[0].(int); isIndex && i >= 0 && i < len(inherited.Items) {
+				return pointerAt(inherited.Items[i], tokens[1:]...)
+			}
+		}
+		return pointerAt(pointer, tokens...)
+	}
+}
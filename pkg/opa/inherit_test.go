@@ -0,0 +1,130 @@
+package opa
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestInheritExtensions(t *testing.T) {
+	swagger := loadTestSpec(t, `
+openapi: 3.0.0
+info: {title: inherit, version: "1"}
+x-security-rego-roles: [admin]
+x-security-rego-public: false
+tags:
+  - name: pets
+    x-security-rego-roles: [vet]
+  - name: store
+    x-security-rego-merge: [x-security-rego-roles]
+    x-security-rego-roles: [clerk]
+paths:
+  /pets:
+    x-security-rego-merge: [x-security-rego-roles, x-security-rego-public]
+    x-security-rego-roles: [owner]
+    x-security-rego-public: true
+    get:
+      operationId: listPets
+      responses: {"200": {description: ok}}
+    post:
+      operationId: createPets
+      tags: [pets]
+      responses: {"200": {description: ok}}
+    put:
+      operationId: updatePets
+      tags: [store, pets]
+      x-security-rego-merge: [x-security-rego-roles]
+      x-security-rego-roles: [keeper]
+      responses: {"200": {description: ok}}
+    delete:
+      operationId: deletePets
+      tags: [pets, store]
+      x-security-rego-roles: []
+      responses: {"200": {description: ok}}
+`)
+
+	tests := []struct {
+		operationID string
+		roles       []string
+		levels      []string
+		pointer     string
+		items       []string
+	}{
+		{
+			operationID: "listPets",
+			roles:       []string{"admin", "owner"},
+			levels:      []string{"document", "path"},
+			pointer:     "#/paths/~1pets/x-security-rego-roles",
+			items:       []string{"#/x-security-rego-roles/0", "#/paths/~1pets/x-security-rego-roles/0"},
+		},
+		{
+			operationID: "createPets",
+			roles:       []string{"vet", "owner"},
+			levels:      []string{"tag pets", "path"},
+			pointer:     "#/paths/~1pets/x-security-rego-roles",
+			items:       []string{"#/tags/0/x-security-rego-roles/0", "#/paths/~1pets/x-security-rego-roles/0"},
+		},
+		{
+			operationID: "updatePets",
+			roles:       []string{"vet", "clerk", "owner", "keeper"},
+			levels:      []string{"tag pets", "tag store", "path", "operation"},
+			pointer:     "#/paths/~1pets/put/x-security-rego-roles",
+			items: []string{
+				"#/tags/0/x-security-rego-roles/0",
+				"#/tags/1/x-security-rego-roles/0",
+				"#/paths/~1pets/x-security-rego-roles/0",
+				"#/paths/~1pets/put/x-security-rego-roles/0",
+			},
+		},
+		{
+			operationID: "deletePets",
+			roles:       []string{},
+			levels:      []string{"operation"},
+			pointer:     "#/paths/~1pets/delete/x-security-rego-roles",
+			items:       []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.operationID, func(t *testing.T) {
+			var levels []extensionLevel
+			for method, operation := range swagger.Paths["/pets"].Operations() {
+				if operation.OperationID == test.operationID {
+					levels = extensionLevels(swagger, "/pets", method, operation)
+				}
+			}
+			if levels == nil {
+				t.Fatalf("no operation %v", test.operationID)
+			}
+
+			extensions, inherited := inheritExtensions(levels)
+			var roles []string
+			if err := json.Unmarshal(extensions[oasSecExtRegoRoles].(json.RawMessage), &roles); err != nil {
+				t.Fatalf("roles: %v", err)
+			}
+			if !reflect.DeepEqual(roles, test.roles) {
+				t.Errorf("got roles %q, want %q", roles, test.roles)
+			}
+
+			extension := inherited[oasSecExtRegoRoles]
+			if !reflect.DeepEqual(extension.Levels, test.levels) {
+				t.Errorf("got levels %q, want %q", extension.Levels, test.levels)
+			}
+			if pointer := specPointer(extension.Pointer...); pointer != test.pointer {
+				t.Errorf("got pointer %v, want %v", pointer, test.pointer)
+			}
+			items := []string{}
+			for _, item := range extension.Items {
+				items = append(items, specPointer(item...))
+			}
+			if !reflect.DeepEqual(items, test.items) {
+				t.Errorf("got item pointers %q, want %q", items, test.items)
+			}
+
+			// values which are not lists are replaced even if they are merged
+			if public := string(extensions[oasSecExtRegoPublic].(json.RawMessage)); public != "true" {
+				t.Errorf("got public %v, want true", public)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package opa
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+const (
+	// TokenJWT reads the token as an encoded JWT from the input
+	TokenJWT = "jwt"
+
+	// TokenBearer reads the token as an encoded JWT from the value of an
+	// authorization header, ie. "Bearer <JWT>"
+	TokenBearer = "bearer"
+
+	// TokenPayload reads the payload of the token from the input, eg. when the
+	// JWT has already been verified and decoded by a gateway
+	TokenPayload = "payload"
+
+	// PathSegments is the format of a request path given as an array of segments
+	PathSegments = "segments"
+
+	// PathString is the format of a request path given as the raw string,
+	// eg. "/pets/1?limit=10". The policy splits it into segments.
+	PathString = "string"
+
+	// PresetDefault is the input mapping of the OPA HTTP API authorization example
+	PresetDefault = "default"
+
+	// PresetHTTP is the input mapping of a generic HTTP request
+	PresetHTTP = "http"
+
+	// PresetEnvoy is the input mapping of an Envoy ext_authz check request
+	PresetEnvoy = "envoy"
+
+	// requestPathRuleName is the name of the rule splitting a raw request path
+	requestPathRuleName = "request_path"
+)
+
+// InputMapping maps the input document sent by a gateway to the fields read by
+// the generated policy and defines how the token is read
+type InputMapping struct {
+	InputFields
+	TokenSource string `json:"token_source,omitempty"`
+}
+
+// InputPresets are the built-in input mappings
+var InputPresets = map[string]InputMapping{
+	PresetDefault: {
+		InputFields: defaultInputFields,
+		TokenSource: TokenJWT,
+	},
+	PresetHTTP: {
+		InputFields: InputFields{
+			Path:       "path",
+			PathFormat: PathString,
+			Method:     "method",
+			Token:      "headers.authorization",
+			Object:     "body",
+		},
+		TokenSource: TokenBearer,
+	},
+	PresetEnvoy: {
+		InputFields: InputFields{
+			Path:       "attributes.request.http.path",
+			PathFormat: PathString,
+			Method:     "attributes.request.http.method",
+			Token:      "attributes.request.http.headers.authorization",
+			Object:     "parsed_body",
+		},
+		TokenSource: TokenBearer,
+	},
+}
+
+// InputFields defines the fields of the input document the generated policy reads.
+// Fields are Rego refs relative to the input, eg. "attributes.request.http.method".
+type InputFields struct {
+	// Path holds the request path in the path format
+	Path string `json:"path,omitempty"`
+
+	// PathFormat is either PathSegments or PathString
+	PathFormat string `json:"path_format,omitempty"`
+
+	// Method holds the request method in upper case
+	Method string `json:"method,omitempty"`
+
+	// Token holds the token as read by the token source
+	Token string `json:"token,omitempty"`
+
+	// Object holds the response object filtered by the overwrite filters
+	Object string `json:"object,omitempty"`
+}
+
+// defaultInputFields are the fields read from the input if not set
+var defaultInputFields = InputFields{
+	Path:       "path",
+	PathFormat: PathSegments,
+	Method:     "method",
+	Token:      "token",
+	Object:     "object",
+}
+
+// withDefaults returns the input fields with the unset fields set to the defaults
+func (f InputFields) withDefaults() InputFields {
+	if f.Path == "" {
+		f.Path = defaultInputFields.Path
+	}
+	if f.PathFormat == "" {
+		f.PathFormat = defaultInputFields.PathFormat
+	}
+	if f.Method == "" {
+		f.Method = defaultInputFields.Method
+	}
+	if f.Token == "" {
+		f.Token = defaultInputFields.Token
+	}
+	if f.Object == "" {
+		f.Object = defaultInputFields.Object
+	}
+	return f
+}
+
+// ref returns the Rego ref of an input field given by name. A path given as
+// string is read from the rule splitting it into segments.
+func (f InputFields) ref(name string) (string, error) {
+	f = f.withDefaults()
+	if name == "path" && f.PathFormat == PathString {
+		return requestPathRuleName, nil
+	}
+
+	fields := map[string]string{
+		"path":   f.Path,
+		"method": f.Method,
+		"token":  f.Token,
+		"object": f.Object,
+	}
+
+	field, ok := fields[name]
+	if !ok {
+		return "", fmt.Errorf("unknown input field %v", name)
+	}
+	return fmt.Sprintf("%v.%v", inputPrefix, field), nil
+}
+
+// tokenTemplates are the templates of the rule decoding the token per token source.
+// The payload of the token is available as token.payload to the generated rules.
+var tokenTemplates = map[string]string{
+	TokenJWT:     `token {{assign}} {"payload": payload}{{ifkw}} { io.jwt.decode({{input "token"}}, [_, payload, _]) }`,
+	TokenBearer:  `token {{assign}} {"payload": payload}{{ifkw}} { [_, encoded] := split({{input "token"}}, " "); io.jwt.decode(encoded, [_, payload, _]) }`,
+	TokenPayload: `token {{assign}} {"payload": {{input "token"}}}`,
+}
+
+// requestPathTemplate is the template of the rule splitting a raw request path into
+// segments like the paths of the spec. The query string and a trailing slash are
+// dropped, the root path is the single segment "/".
+var requestPathTemplate = `
+
+request_path = split(path, "/"){{ifkw}} { path := trim(split({{.}}, "?")[0], "/"); path != "" }
+
+request_path = ["/"]{{ifkw}} { trim(split({{.}}, "?")[0], "/") == "" }`
+
+// templateFuncs returns the functions of the templates generating Rego. Next to the
+// functions rendering the syntax of the Rego version, "input" renders the ref of an
+// input field, "tokenRule" the rule decoding the token, "pathRule" the rule
+// splitting a raw request path and "permissionsRules" the rules checking the
+// permissions, if any.
+func templateFuncs(options Options) (template.FuncMap, error) {
+	funcs, err := regoFuncs(options.RegoVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	input := options.Input.withDefaults()
+	funcs["input"] = input.ref
+
+	switch input.PathFormat {
+	case PathSegments:
+		funcs["pathRule"] = func() string { return "" }
+	case PathString:
+		rule, err := executeTemplate(requestPathTemplate, funcs, fmt.Sprintf("%v.%v", inputPrefix, input.Path))
+		if err != nil {
+			return nil, err
+		}
+		funcs["pathRule"] = func() string { return rule }
+	default:
+		return nil, fmt.Errorf("unknown path format %v, use %v or %v", input.PathFormat, PathSegments, PathString)
+	}
+
+	source := options.TokenSource
+	if source == "" {
+		source = TokenJWT
+	}
+	tokenTemplate, ok := tokenTemplates[source]
+	if !ok {
+		return nil, fmt.Errorf("unknown token source %v, use %v, %v or %v", source, TokenJWT, TokenBearer, TokenPayload)
+	}
+
+	rule, err := executeTemplate(tokenTemplate, funcs, nil)
+	if err != nil {
+		return nil, err
+	}
+	funcs["tokenRule"] = func() string { return rule }
+
+	permissions, err := permissionsRules(options, funcs)
+	if err != nil {
+		return nil, err
+	}
+	funcs["permissionsRules"] = func() string { return permissions }
+	return funcs, nil
+}
+
+// executeTemplate executes a template of a Rego snippet with the data
+func executeTemplate(text string, funcs template.FuncMap, data interface{}) (string, error) {
+	t, err := template.New("snippet_template").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = t.Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
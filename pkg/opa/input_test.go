@@ -0,0 +1,94 @@
+package opa
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPathSegments(t *testing.T) {
+	tests := []struct {
+		path     string
+		segments []string
+		parsed   string
+	}{
+		{path: "/", segments: []string{"/"}, parsed: `["/"]`},
+		{path: "/pets", segments: []string{"pets"}, parsed: `["pets"]`},
+		{path: "/pets/", segments: []string{"pets"}, parsed: `["pets"]`},
+		{path: "/pets/{petId}", segments: []string{"pets", "{petId}"}, parsed: `["pets", petId]`},
+		{path: "/pets/{petId}/owners/", segments: []string{"pets", "{petId}", "owners"}, parsed: `["pets", petId, "owners"]`},
+	}
+
+	for _, test := range tests {
+		if segments := pathSegments(test.path); !reflect.DeepEqual(segments, test.segments) {
+			t.Errorf("pathSegments(%q) = %q, want %q", test.path, segments, test.segments)
+		}
+		if parsed := convertOASPathToParsedPath(test.path); parsed != test.parsed {
+			t.Errorf("convertOASPathToParsedPath(%q) = %v, want %v", test.path, parsed, test.parsed)
+		}
+	}
+}
+
+func TestRequestPathRule(t *testing.T) {
+	tests := []struct {
+		options Options
+		rules   []string
+	}{
+		{
+			options: Options{Input: InputPresets[PresetHTTP].InputFields},
+			rules: []string{
+				`request_path = split(path, "/") if { path := trim(split(input.path, "?")[0], "/"); path != "" }`,
+				`request_path = ["/"] if { trim(split(input.path, "?")[0], "/") == "" }`,
+			},
+		},
+		{
+			options: Options{Input: InputPresets[PresetHTTP].InputFields, RegoVersion: RegoV0},
+			rules: []string{
+				`request_path = split(path, "/") { path := trim(split(input.path, "?")[0], "/"); path != "" }`,
+				`request_path = ["/"] { trim(split(input.path, "?")[0], "/") == "" }`,
+			},
+		},
+		{
+			options: Options{},
+			rules:   nil,
+		},
+	}
+
+	for _, test := range tests {
+		funcs, err := templateFuncs(test.options)
+		if err != nil {
+			t.Fatalf("templateFuncs: %v", err)
+		}
+
+		rule := funcs["pathRule"].(func() string)()
+		for _, expected := range test.rules {
+			if !strings.Contains(rule, expected) {
+				t.Errorf("path rule %q does not contain %q", rule, expected)
+			}
+		}
+		if test.rules == nil && rule != "" {
+			t.Errorf("unexpected path rule %q for segments", rule)
+		}
+	}
+}
+
+func TestRootPathRoute(t *testing.T) {
+	swagger := loadTestSpec(t, `
+openapi: 3.0.0
+info: {title: root, version: "1"}
+paths:
+  /:
+    get:
+      operationId: root
+      responses: {"200": {description: ok}}
+`)
+
+	o := sortedOperations(swagger)[0]
+	route, errs := buildRouteTable(swagger, operationModel{operationRef: o}, specModel{}, Options{})
+	if len(errs) > 0 {
+		t.Fatalf("buildRouteTable: %v", errs)
+	}
+	if expected := [][]interface{}{{0, "/"}}; !reflect.DeepEqual(route.Literals, expected) {
+		t.Errorf("literals = %v, want %v", route.Literals, expected)
+	}
+}
@@ -0,0 +1,207 @@
+package opa
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const (
+	// LayoutSingle generates the whole policy in a single package and file
+	LayoutSingle = "single"
+
+	// LayoutTag generates a package per operation tag and a router package
+	LayoutTag = "tag"
+
+	// LayoutPath generates a package per path prefix and a router package
+	LayoutPath = "path"
+
+	// policyFileName is the name of every generated Rego file
+	policyFileName = "policy.rego"
+
+	// defaultGroup is the package for operations without a tag or path prefix
+	defaultGroup = "root"
+)
+
+var (
+	invalidPackageCharRE = regexp.MustCompile("[^a-z0-9_]+")
+
+	// reservedGroups cannot be used as package names as they are either Rego
+	// keywords or clash with the rules generated in the router package
+	reservedGroups = map[string]bool{
+		"allow": true, "filter": true, "list_filter": true, "response": true, "token": true, "request_path": true, "result": true, "permissions": true,
+		"decision": true, "operations": true, "operation_id": true, "reasons": true, "matched_rules": true,
+		"package": true, "import": true, "default": true, "not": true, "with": true, "as": true,
+		"else": true, "some": true, "in": true, "if": true, "contains": true, "every": true,
+		"true": true, "false": true, "null": true, "data": true, "input": true,
+	}
+)
+
+var routerTemplate = `package %s
+{{header}}default allow {{assign}} false{{pathRule}}
+{{range .Operations}}
+allow{{ifkw}} {
+  {{input "path"}} = {{.Path}}
+  {{input "method"}} = {{.Method}}
+  data.{{$.PackageName}}.{{.Group}}.allow
+}
+{{end}}{{range .Groups}}
+filter = f{{ifkw}} {
+  f := data.{{$.PackageName}}.{{.}}.filter
+}
+
+list_filter{{contains "x"}}{{ifkw}} {
+  data.{{$.PackageName}}.{{.}}.list_filter[x]
+}
+
+response[field] = value{{ifkw}} {
+  data.{{$.PackageName}}.{{.}}.response[field] = value
+}
+{{if $.Decision}}
+decision = d{{ifkw}} {
+  count(data.{{$.PackageName}}.{{.}}.operations) > 0
+  d := data.{{$.PackageName}}.{{.}}.decision
+}
+{{end}}{{end}}{{if .Decision}}
+default decision {{assign}} {
+  "allowed": false,
+  "reasons": ["no operation in the specification matches the request"],
+  "matched_rules": [],
+  "operation_id": null,
+}
+{{end}}`
+
+// File is a generated policy file. Name is relative to the output directory.
+type File struct {
+	Name    string
+	Content string
+}
+
+// router is the data the router template is executed with
+type router struct {
+	PackageName string
+	Operations  []operationSchema
+	Groups      []string
+	Decision    bool
+}
+
+// operationGroup returns the name of the package an operation is generated in
+func operationGroup(oasPath string, operation *openapi3.Operation, layout string) string {
+	var group string
+	switch layout {
+	case LayoutTag:
+		if len(operation.Tags) > 0 {
+			group = operation.Tags[0]
+		}
+	case LayoutPath:
+		prefix := strings.Split(strings.TrimLeft(oasPath, "/"), "/")[0]
+		if !pathParamRE.MatchString(prefix) {
+			group = prefix
+		}
+	default:
+		return ""
+	}
+
+	group = strings.Trim(invalidPackageCharRE.ReplaceAllString(strings.ToLower(group), "_"), "_")
+	if group == "" {
+		return defaultGroup
+	}
+	if group[0] >= '0' && group[0] <= '9' || reservedGroups[group] {
+		group = "_" + group
+	}
+	return group
+}
+
+// generateFiles generates the Rego files for the policy according to the layout.
+// Split layouts generate a package per group in "<group>/policy.rego" and a
+// router package in "policy.rego" which dispatches requests to the groups.
+func generateFiles(p policy, options Options) ([]File, error) {
+	switch options.Layout {
+	case "", LayoutSingle:
+		rego, err := generateRego(p, options.PackageName, options)
+		if err != nil {
+			return nil, err
+		}
+		return []File{{Name: policyFileName, Content: rego}}, nil
+	case LayoutTag, LayoutPath:
+	default:
+		return nil, fmt.Errorf("unknown layout %v, use %v, %v or %v", options.Layout, LayoutSingle, LayoutTag, LayoutPath)
+	}
+
+	groups := map[string]*policy{}
+	for _, schema := range p.Schemas {
+		g := groupPolicy(groups, schema.Group, p.Decision)
+		g.Schemas = append(g.Schemas, schema)
+	}
+	for _, operation := range p.Operations {
+		g := groupPolicy(groups, operation.Group, p.Decision)
+		g.Operations = append(g.Operations, operation)
+	}
+	// the helper rules of the named conditions are generated in every group calling them
+	for _, helper := range p.Conditions {
+		for _, name := range sortedKeys(helper.Groups) {
+			g := groupPolicy(groups, name, p.Decision)
+			g.Conditions = append(g.Conditions, helper)
+		}
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	r := router{
+		PackageName: options.PackageName,
+		Operations:  p.Operations,
+		Groups:      names,
+		Decision:    p.Decision,
+	}
+
+	funcs, err := templateFuncs(options)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := template.New("router_template").Funcs(funcs).Parse(fmt.Sprintf(routerTemplate, options.PackageName))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = t.Execute(&buf, r)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []File{{Name: policyFileName, Content: buf.String()}}
+	for _, name := range names {
+		rego, err := generateRego(*groups[name], fmt.Sprintf("%v.%v", options.PackageName, name), options)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Name: groupFileName(name), Content: rego})
+	}
+	return files, nil
+}
+
+// groupFileName returns the name of the file the rules of a group are generated into
+func groupFileName(group string) string {
+	if group == "" {
+		return policyFileName
+	}
+	return path.Join(group, policyFileName)
+}
+
+func groupPolicy(groups map[string]*policy, name string, decision bool) *policy {
+	if _, ok := groups[name]; !ok {
+		groups[name] = &policy{Decision: decision}
+	}
+	return groups[name]
+}
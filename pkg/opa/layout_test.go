@@ -0,0 +1,68 @@
+package opa
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSplitLayout(t *testing.T) {
+	swagger := loadTestSpec(t, testPetstore)
+
+	tests := []struct {
+		options Options
+		files   []string
+	}{
+		{
+			options: Options{Layout: LayoutTag},
+			files:   []string{"pets/policy.rego", "policy.rego", "store/policy.rego"},
+		},
+		{
+			options: Options{Layout: LayoutPath, Decision: true},
+			files:   []string{"pets/policy.rego", "policy.rego", "store/policy.rego"},
+		},
+		{
+			options: Options{Layout: LayoutTag, RegoVersion: RegoV0, Target: TargetEnvoy},
+			files:   []string{"pets/policy.rego", "policy.rego", "store/policy.rego"},
+		},
+	}
+
+	for _, test := range tests {
+		test.options.PackageName = DefaultPackageName
+		files, err := GenerateFiles(swagger, test.options)
+		if err != nil {
+			t.Fatalf("%+v: %v", test.options, err)
+		}
+
+		names := []string{}
+		for _, file := range files {
+			names = append(names, file.Name)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, test.files) {
+			t.Errorf("%+v: files %v, want %v", test.options, names, test.files)
+		}
+
+		modules := checkRegoFiles(t, files)
+		router := modules[policyFileName]
+		if router == nil {
+			continue
+		}
+		// the router defines allow once per operation and the other rules once per group
+		counts := map[string]int{}
+		for _, rule := range router.Rules {
+			if !rule.Default {
+				counts[rule.Name]++
+			}
+		}
+		if counts["allow"] != 4 {
+			t.Errorf("%+v: router defines allow %v times, want 4", test.options, counts["allow"])
+		}
+		if counts["filter"] != 2 {
+			t.Errorf("%+v: router defines filter %v times, want 2", test.options, counts["filter"])
+		}
+		if test.options.Decision && counts["decision"] != 2 {
+			t.Errorf("%+v: router defines decision %v times, want 2", test.options, counts["decision"])
+		}
+	}
+}
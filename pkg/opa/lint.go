@@ -0,0 +1,333 @@
+package opa
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/openapi-to-rego/pkg/rego"
+)
+
+const (
+	// SeverityError is the severity of problems which make the generated policy invalid or wrong
+	SeverityError = "error"
+
+	// SeverityWarning is the severity of problems which may be intended
+	SeverityWarning = "warning"
+
+	// oasSecExtRegoPrefix is the common prefix of the OpenAPI extensions
+	oasSecExtRegoPrefix = "x-security-rego-"
+)
+
+// Kinds of problems reported by Lint
+const (
+	ProblemUnknownExtension = "unknown-extension"
+	ProblemInvalidType      = "invalid-type"
+	ProblemUnknownKey       = "unknown-key"
+	ProblemMissingKey       = "missing-key"
+	ProblemUnknownOperator  = "unknown-operator"
+	ProblemOperandCount     = "operand-count"
+	ProblemUndeclaredParam  = "undeclared-path-parameter"
+	ProblemUnknownScheme    = "unknown-security-scheme"
+	ProblemMissingSecurity  = "missing-security"
+	ProblemInvalidJSON      = "invalid-json"
+	ProblemUnknownCondition = "unknown-condition"
+	ProblemInvalidCondition = "invalid-condition"
+	ProblemInvalidDataRef   = "invalid-data-reference"
+	ProblemInvalidTenant    = "invalid-tenant"
+	ProblemMissingTenant    = "missing-tenant-source"
+	ProblemInvalidTerm      = "invalid-term"
+)
+
+// ProblemDescriptions describes each kind of problem
+var ProblemDescriptions = map[string]string{
+	ProblemUnknownExtension: "Extension with the x-security-rego- prefix which is not supported",
+	ProblemInvalidType:      "Value of an extension with the wrong type",
+	ProblemUnknownKey:       "Key which is not supported by an extension",
+	ProblemMissingKey:       "Key required by an extension is missing",
+	ProblemUnknownOperator:  "Operator which is not supported",
+	ProblemOperandCount:     "Operator with the wrong number of operands",
+	ProblemUndeclaredParam:  "Reference to a path parameter the operation does not declare",
+	ProblemUnknownScheme:    "Field filter for a security scheme missing from the security requirements of the operation",
+	ProblemMissingSecurity:  "Operation without security requirements",
+	ProblemInvalidJSON:      "Extension which is not valid JSON",
+	ProblemUnknownCondition: "Reference to a named condition the components do not define",
+	ProblemInvalidCondition: "Named condition with an illegal name or referencing another condition",
+	ProblemInvalidDataRef:   "Operand referencing the resource data with an illegal reference",
+	ProblemInvalidTenant:    "Tenant extension with an illegal claim or source",
+	ProblemMissingTenant:    "Operation which is not exempt from the tenant check without any of the tenant sources",
+	ProblemInvalidTerm:      "Operand or overwrite value which is not a valid Rego term",
+}
+
+// Problem is a problem found in the OpenAPI extensions of a spec
+type Problem struct {
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	Pointer  string `json:"pointer"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message"`
+}
+
+func newProblem(kind string, pointer []interface{}, format string, args ...interface{}) Problem {
+	severity := SeverityError
+	if kind == ProblemMissingSecurity {
+		severity = SeverityWarning
+	}
+	return Problem{
+		Kind:     kind,
+		Severity: severity,
+		Pointer:  specPointer(pointer...),
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// Lint checks the OpenAPI extensions of the document, the tags, the path items and
+// the operations in the spec against their schema and the operations they are
+// defined for, and returns the problems found
+func Lint(swagger *openapi3.Swagger) []Problem {
+	problems := lintExtensions(swagger.Extensions, nil, documentExtensionSchemas)
+	for i, tag := range tagExtensions(swagger) {
+		problems = append(problems, lintExtensions(tag.Extensions, []interface{}{tagsField, i}, extensionSchemas)...)
+	}
+	for _, path := range sortedKeys(swagger.Paths) {
+		problems = append(problems, lintExtensions(swagger.Paths[path].Extensions, []interface{}{"paths", path}, extensionSchemas)...)
+	}
+	problems = append(problems, lintExtensions(swagger.Components.Extensions, []interface{}{"components"}, componentExtensionSchemas)...)
+
+	// the schema reports the conditions which cannot be decoded
+	conditions, errs := loadConditions(swagger)
+	if conditions != nil {
+		for _, e := range errs {
+			problems = append(problems, Problem{Kind: ProblemInvalidCondition, Severity: SeverityError, Pointer: e.Pointer, Message: e.Message})
+		}
+	}
+	tenant, errs := loadTenant(swagger)
+	if tenant != nil {
+		for _, e := range errs {
+			problems = append(problems, Problem{Kind: ProblemInvalidTenant, Severity: SeverityError, Pointer: e.Pointer, Message: e.Message})
+		}
+	}
+
+	for _, o := range sortedOperations(swagger) {
+		path, method, operation := o.Path, o.Method, o.Operation
+		pointer := []interface{}{"paths", path, strings.ToLower(method)}
+
+		security := swagger.Security
+		if operation.Security != nil {
+			security = *operation.Security
+		}
+		if public, _ := isPublic(operation); len(security) == 0 && !public {
+			problems = append(problems, newProblem(ProblemMissingSecurity, pointer, "operation has no security requirements"))
+		}
+
+		// operations which are not exempt need one of the tenant sources, the schema
+		// reports the exempt extensions which cannot be decoded
+		var tenantErrs Errors
+		if _, ok := tenant.operationSource(o, &tenantErrs); !ok && len(tenantErrs) > 0 && tenantErrs[0].Pointer == specPointer(pointer...) {
+			problems = append(problems, newProblem(ProblemMissingTenant, pointer, "%v", tenantErrs[0].Message))
+		}
+
+		// the extensions of the operation itself, the inherited extensions are
+		// checked where they are defined
+		problems = append(problems, lintExtensions(swagger.Paths[path].GetOperation(method).Extensions, pointer, extensionSchemas)...)
+
+		// the effective extensions are checked against the operation
+		for _, name := range sortedKeys(o.Inherited) {
+			var items []interface{}
+			if data, ok := operation.Extensions[name].(json.RawMessage); !ok || json.Unmarshal(data, &items) != nil {
+				continue
+			}
+
+			extension := o.extensionPointer(name)
+			for i, item := range items {
+				problems = append(problems, lintPathParams(item, extension(i), pathParams(swagger.Paths[path], operation), conditions)...)
+				problems = append(problems, lintTerms(item, extension(i), name, conditions)...)
+			}
+			if name == oasSecExtRegoFieldFilter {
+				problems = append(problems, lintFieldFilterSchemes(items, extension, operation)...)
+			}
+		}
+	}
+	return uniqueProblems(problems)
+}
+
+// uniqueProblems returns the problems without the duplicates reported for the
+// operations inheriting the same extension, in their order
+func uniqueProblems(problems []Problem) []Problem {
+	result := []Problem{}
+	seen := map[Problem]bool{}
+	for _, problem := range problems {
+		if !seen[problem] {
+			seen[problem] = true
+			result = append(result, problem)
+		}
+	}
+	return result
+}
+
+// lintExtensions validates the x-security-rego extensions against their schemas
+// and reports the unknown extensions. The pointer locates the extensions in the spec.
+func lintExtensions(extensions map[string]interface{}, pointer []interface{}, schemas map[string]*jsonSchema) []Problem {
+	problems := []Problem{}
+
+	names := make([]string, 0, len(extensions))
+	for name := range extensions {
+		if strings.HasPrefix(name, oasSecExtRegoPrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		at := pointerAt(pointer, name)
+
+		schema, ok := schemas[name]
+		if !ok {
+			problems = append(problems, newProblem(ProblemUnknownExtension, at, "unknown extension %v", name))
+			continue
+		}
+
+		var value interface{}
+		data, ok := extensions[name].(json.RawMessage)
+		if !ok || json.Unmarshal(data, &value) != nil {
+			problems = append(problems, newProblem(ProblemInvalidJSON, at, "extension %v is not valid JSON", name))
+			continue
+		}
+		problems = append(problems, schema.validate(value, at)...)
+	}
+	return problems
+}
+
+// lintPathParams reports the "$" operands and data references referencing path
+// parameters which are not declared, also by the named conditions referenced, the
+// unknown conditions and the illegal data references
+func lintPathParams(value interface{}, pointer []interface{}, params map[string]bool, conditions namedConditions) []Problem {
+	problems := []Problem{}
+
+	switch val := value.(type) {
+	case []interface{}:
+		for i, item := range val {
+			problems = append(problems, lintPathParams(item, pointerAt(pointer, i), params, conditions)...)
+		}
+	case map[string]interface{}:
+		for _, key := range sortedKeys(val) {
+			if key == "operations" || key == "rules" {
+				problems = append(problems, lintPathParams(val[key], pointerAt(pointer, key), params, conditions)...)
+			} else if isReference(key) {
+				name, err := conditions.reference(key, []interface{}{val[key]})
+				if err != nil {
+					problems = append(problems, newProblem(ProblemUnknownCondition, pointerAt(pointer, key), "%v", err))
+					continue
+				}
+				for _, param := range conditions.params(name) {
+					if !params[param] {
+						problems = append(problems, newProblem(ProblemUndeclaredParam, pointerAt(pointer, key), "condition %v references path parameter %v which is not declared by the operation", name, param))
+					}
+				}
+			} else if _, ok := operandCounts[key]; ok {
+				operands, _ := val[key].([]interface{})
+				for i, operand := range operands {
+					if ref, ok := dataOperand(operand); ok {
+						if _, err := parseDataRef(ref); err != nil {
+							problems = append(problems, newProblem(ProblemInvalidDataRef, pointerAt(pointer, key, i, dataOperandKey), "%v", err))
+						}
+					}
+					for _, name := range operandParams(operand) {
+						if !params[name] {
+							problems = append(problems, newProblem(ProblemUndeclaredParam, pointerAt(pointer, key), "operand %d references path parameter %v which is not declared by the operation", i, name))
+						}
+					}
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// lintTerms reports the operands and the overwrite values of the extension which
+// are not rendered as valid Rego terms, also in the named conditions referenced as
+// their operands are interpreted like in the extension
+func lintTerms(value interface{}, pointer []interface{}, extension string, conditions namedConditions) []Problem {
+	problems := []Problem{}
+
+	switch val := value.(type) {
+	case []interface{}:
+		for i, item := range val {
+			problems = append(problems, lintTerms(item, pointerAt(pointer, i), extension, conditions)...)
+		}
+	case map[string]interface{}:
+		for _, key := range sortedKeys(val) {
+			if key == "operations" || key == "rules" {
+				problems = append(problems, lintTerms(val[key], pointerAt(pointer, key), extension, conditions)...)
+			} else if key == "value" && extension == oasSecExtRegoOverwriteFilter {
+				// the value is inserted as is
+				if s, ok := val[key].(string); ok {
+					if _, err := rego.ParseTerm(s); err != nil {
+						problems = append(problems, newProblem(ProblemInvalidTerm, pointerAt(pointer, key), "value %q is not a valid Rego term: %v", s, err))
+					}
+				}
+			} else if isReference(key) {
+				name, err := conditions.reference(key, []interface{}{val[key]})
+				if err != nil {
+					continue
+				}
+				for k, operation := range conditions[name] {
+					items := map[string]interface{}{}
+					for op, operands := range operation {
+						items[op] = operands
+					}
+					problems = append(problems, lintTerms(items, conditionPointer(name, k), extension, conditions)...)
+				}
+			} else if _, ok := operandCounts[key]; ok {
+				operands, _ := val[key].([]interface{})
+				for i, operand := range operands {
+					s, ok := operand.(string)
+					if !ok {
+						continue
+					}
+					term, _ := regoOperand(s, key, extension, defaultInputFields, "")
+					if _, err := rego.ParseTerm(strings.TrimPrefix(term, "not ")); err != nil {
+						problems = append(problems, newProblem(ProblemInvalidTerm, pointerAt(pointer, key, i), "operand %q is not a valid Rego term: %v", s, err))
+					}
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// lintFieldFilterSchemes reports the field filters for schemes the operation does not require
+func lintFieldFilterSchemes(filters []interface{}, pointer func(tokens ...interface{}) []interface{}, operation *openapi3.Operation) []Problem {
+	problems := []Problem{}
+
+	schemes := map[string][]string{}
+	if operation.Security != nil {
+		schemes = getSecuritySchemes(operation.Security)
+	}
+
+	for i, filter := range filters {
+		definitions, _ := filter.(map[string]interface{})
+		for _, name := range sortedKeys(definitions) {
+			if _, ok := schemes[name]; !ok {
+				problems = append(problems, newProblem(ProblemUnknownScheme, pointer(i, name), "security scheme %v is missing from the security requirements of the operation", name))
+			}
+		}
+	}
+	return problems
+}
+
+// pathParams returns the names of the path parameters declared by the operation and its path item
+func pathParams(pathItem *openapi3.PathItem, operation *openapi3.Operation) map[string]bool {
+	params := map[string]bool{}
+	for _, parameters := range []openapi3.Parameters{pathItem.Parameters, operation.Parameters} {
+		for _, ref := range parameters {
+			if ref != nil && ref.Value != nil && ref.Value.In == openapi3.ParameterInPath {
+				params[ref.Value.Name] = true
+			}
+		}
+	}
+	return params
+}
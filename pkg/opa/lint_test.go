@@ -0,0 +1,70 @@
+package opa
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLintTerms(t *testing.T) {
+	swagger := loadTestSpec(t, `
+openapi: 3.0.0
+info: {title: terms, version: "1"}
+security: [{oauth: [read:pets]}]
+paths:
+  /pets:
+    get:
+      x-security-rego-list-filter:
+        - source: list
+          operations:
+            - condition: named
+            - eq: [owner, token.payload.sub]
+      x-security-rego-overwrite-filter:
+        - field: name
+          value: hello world
+          rules:
+            - operations:
+                - eq: [name, '"valid"']
+        - field: owner
+          value: '"hidden"'
+          rules:
+            - operations:
+                - eq: [owner name, token.payload.sub]
+        - field: tag
+          value: token.payload.sub
+          rules:
+            - operations:
+                - condition: named
+      x-security-rego-boolean-filter:
+        - rules:
+            - operations:
+                - eq: [token.payload.sub, 'input.owner[']
+                - negation: [token.payload.blocked]
+                - gte: [token.payload.age, 18]
+      responses: {"200": {description: ok}}
+components:
+  securitySchemes:
+    oauth:
+      type: oauth2
+      flows: {implicit: {authorizationUrl: "https://example.com", scopes: {read:pets: read}}}
+  x-security-rego-conditions:
+    named:
+      - eq: ['"quoted"', token.payload.sub]
+`)
+
+	got := []string{}
+	for _, problem := range Lint(swagger) {
+		if problem.Kind == ProblemInvalidTerm {
+			got = append(got, problem.Pointer)
+		}
+	}
+	want := []string{
+		"#/paths/~1pets/get/x-security-rego-boolean-filter/0/rules/0/operations/0/eq/1",
+		// the quoted string is a field of the list item in list filters
+		"#/components/x-security-rego-conditions/named/0/eq/0",
+		"#/paths/~1pets/get/x-security-rego-overwrite-filter/0/value",
+		"#/paths/~1pets/get/x-security-rego-overwrite-filter/1/rules/0/operations/0/eq/0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid terms at %v, want %v", got, want)
+	}
+}
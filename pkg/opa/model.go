@@ -0,0 +1,279 @@
+package opa
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// specModel holds what the operations of a spec are compiled with, loaded once
+// from the document
+type specModel struct {
+	claim      string
+	resources  string
+	hierarchy  roleHierarchy
+	conditions namedConditions
+	tenant     *tenantIsolation
+}
+
+// operationModel is the access control of an operation compiled from its
+// extensions. Both modes build it, the rules mode renders it as Rego rules and
+// the data mode as the tables evaluated by the generic policy.
+type operationModel struct {
+	operationRef
+
+	// ID is the operationId, or the method and path of an operation without one
+	ID string
+
+	// Roles are the roles allowed the operation if HasRoles, including the roles
+	// inheriting them
+	Roles    []string
+	HasRoles bool
+
+	// Tenant is the index of the tenant source of the operation if Isolated
+	Tenant   int
+	Isolated bool
+
+	FieldFilters     []fieldFilterModel
+	ListFilters      []listFilterModel
+	OverwriteFilters []overwriteFilterModel
+
+	// BooleanFilters are the rules of each boolean filter of the operation,
+	// DefaultRule the rule allowing the operation by the strategy, nil if the
+	// boolean filters replace it or the strategy denies the operation
+	BooleanFilters [][]ruleModel
+	DefaultRule    *ruleModel
+}
+
+// fieldFilterModel defines the fields filtered for a security scheme
+type fieldFilterModel struct {
+	Pointer []interface{}
+	Scheme  string
+	Scopes  []string
+	Fields  []string
+}
+
+// listFilterModel defines a list filter, Pointer locates the item of the extension
+type listFilterModel struct {
+	Pointer    []interface{}
+	Source     string
+	Operations []operation
+}
+
+// overwriteFilterModel defines an overwrite filter, Pointer locates the item of the
+// extension and Index its position
+type overwriteFilterModel struct {
+	Pointer []interface{}
+	Index   int
+	Field   string
+	Value   interface{}
+	Negated bool
+	Rules   []rule
+}
+
+// ruleModel defines a rule allowing an operation. Checks is whether the rule
+// requires the roles, the permissions and the tenant of the operation, Scopes are
+// the alternative sets of scopes of which one is required. Operations are located
+// by Pointer.
+type ruleModel struct {
+	ID            string
+	Pointer       []interface{}
+	Operations    []operation
+	Checks        bool
+	Authenticated bool
+	Scopes        [][]string
+}
+
+// loadSpecModel loads the roles claim, the resource data, the role hierarchy, the
+// named conditions and the tenant isolation of the spec. The errors found in the
+// extensions of the document are returned as Errors, the others as error.
+func loadSpecModel(swagger *openapi3.Swagger, options Options) (specModel, Errors, error) {
+	var model specModel
+	err := checkStrategy(options.Strategy)
+	if err != nil {
+		return model, nil, err
+	}
+	if options.Permissions != nil {
+		err := ValidatePermissions(swagger, options.Permissions)
+		if err != nil {
+			return model, nil, fmt.Errorf("invalid permissions: %v", err)
+		}
+	}
+	model.claim, err = rolesClaim(options)
+	if err != nil {
+		return model, nil, err
+	}
+	model.resources, err = resourcesRef(options)
+	if err != nil {
+		return model, nil, err
+	}
+
+	var errs Errors
+	model.hierarchy, err = loadRoleHierarchy(swagger)
+	if err != nil {
+		errs.add([]interface{}{oasSecExtRegoRoleHierarchy}, "%v", err)
+	}
+	var conditionErrs, tenantErrs Errors
+	model.conditions, conditionErrs = loadConditions(swagger)
+	errs = append(errs, conditionErrs...)
+	model.tenant, tenantErrs = loadTenant(swagger)
+	errs = append(errs, tenantErrs...)
+	return model, errs, nil
+}
+
+// buildOperationModel compiles the extensions of an operation into its model and
+// returns the errors found in them. The operations of the filters are compiled by
+// the modes.
+func buildOperationModel(swagger *openapi3.Swagger, o operationRef, spec specModel, options Options) (operationModel, Errors) {
+	operation := o.Operation
+	m := operationModel{operationRef: o, ID: operation.OperationID}
+	if m.ID == "" {
+		m.ID = fmt.Sprintf("%v %v", o.Method, o.Path)
+	}
+	var errs Errors
+
+	// check for "x-security-rego-roles" extension
+	roles, hasRoles, err := operationRoles(operation, spec.hierarchy)
+	if err != nil {
+		errs.add(o.extensionPointer(oasSecExtRegoRoles)(), "%v", err)
+	} else {
+		m.Roles, m.HasRoles = roles, hasRoles
+	}
+
+	// check for "x-security-rego-tenant" extension of the document
+	m.Tenant, m.Isolated = spec.tenant.operationSource(o, &errs)
+
+	// check for "x-security-rego-field-filter" extension
+	if val, ok := operation.ExtensionProps.Extensions[oasSecExtRegoFieldFilter]; ok {
+		extension := o.extensionPointer(oasSecExtRegoFieldFilter)
+
+		var extensionDefinitions []extensionDefinition
+		err := unmarshalExtension(val, &extensionDefinitions)
+		if err != nil {
+			errs.add(extension(), "%v", err)
+		}
+
+		// security requirement object needs to exist as the "x-security-rego-field-filter"
+		// extension references it
+		securitySchemes := map[string][]string{}
+		if operation.Security == nil {
+			errs.add(extension(), "OpenAPI spec does not specify a Security Requirement Object")
+			extensionDefinitions = nil
+		} else {
+			securitySchemes = getSecuritySchemes(operation.Security)
+		}
+
+		for i, extensionDefinition := range extensionDefinitions {
+			for _, schemeName := range sortedKeys(extensionDefinition) {
+				scopes, ok := securitySchemes[schemeName]
+				if !ok {
+					errs.add(extension(i, schemeName), "Unknown security scheme %v in OpenAPI extension", schemeName)
+					continue
+				}
+				m.FieldFilters = append(m.FieldFilters, fieldFilterModel{
+					Pointer: extension(i, schemeName),
+					Scheme:  schemeName,
+					Scopes:  scopes,
+					Fields:  extensionDefinition[schemeName],
+				})
+			}
+		}
+	}
+
+	// check for "x-security-rego-list-filter" extension
+	if val, ok := operation.ExtensionProps.Extensions[oasSecExtRegoListFilter]; ok {
+		extension := o.extensionPointer(oasSecExtRegoListFilter)
+
+		var policySchemaListFilters []policySchemaListFilter
+		err := unmarshalExtension(val, &policySchemaListFilters)
+		if err != nil {
+			errs.add(extension(), "%v", err)
+			policySchemaListFilters = nil
+		}
+
+		for i, p := range policySchemaListFilters {
+			m.ListFilters = append(m.ListFilters, listFilterModel{Pointer: extension(i), Source: p.Source, Operations: p.Operations})
+		}
+	}
+
+	// check for "x-security-rego-overwrite-filter" extension
+	if val, ok := operation.ExtensionProps.Extensions[oasSecExtRegoOverwriteFilter]; ok {
+		extension := o.extensionPointer(oasSecExtRegoOverwriteFilter)
+
+		var policySchemaOverwriteFilters []policySchemaOverwriteFilter
+		err := unmarshalExtension(val, &policySchemaOverwriteFilters)
+		if err != nil {
+			errs.add(extension(), "%v", err)
+			policySchemaOverwriteFilters = nil
+		}
+
+		for i, p := range policySchemaOverwriteFilters {
+			m.OverwriteFilters = append(m.OverwriteFilters, overwriteFilterModel{
+				Pointer: extension(i),
+				Index:   i,
+				Field:   p.Field,
+				Value:   p.Value,
+				Negated: p.Negated,
+				Rules:   p.Rules,
+			})
+		}
+	}
+
+	// check for "x-security-rego-boolean-filter" extension, the roles, the
+	// permissions and the tenant are required by every rule
+	if val, ok := operation.ExtensionProps.Extensions[oasSecExtRegoBooleanFilter]; ok {
+		extension := o.extensionPointer(oasSecExtRegoBooleanFilter)
+
+		var policySchemaBooleanFilters []policySchemaBooleanFilter
+		err := unmarshalExtension(val, &policySchemaBooleanFilters)
+		if err != nil {
+			errs.add(extension(), "%v", err)
+			policySchemaBooleanFilters = nil
+		}
+
+		requiredScopes := scopeAlternatives(swagger, operation)
+		for i, p := range policySchemaBooleanFilters {
+			scopes := requiredScopes
+			if p.IgnoreScopes {
+				scopes = nil
+			}
+
+			rules := []ruleModel{}
+			for j, rule := range p.Rules {
+				rules = append(rules, ruleModel{
+					ID:         specPointer(extension(i, "rules", j)...),
+					Pointer:    extension(i, "rules", j, "operations"),
+					Operations: rule.Operations,
+					Checks:     true,
+					Scopes:     scopes,
+				})
+			}
+			m.BooleanFilters = append(m.BooleanFilters, rules)
+		}
+	}
+
+	// allow the operation by the strategy if boolean filter not defined or the
+	// operation is public
+	_, filtered := operation.ExtensionProps.Extensions[oasSecExtRegoBooleanFilter]
+	public, err := isPublic(operation)
+	if err != nil {
+		errs.add(o.extensionPointer(oasSecExtRegoPublic)(), "%v", err)
+	}
+	if !filtered || public {
+		rule := ruleModel{ID: specPointer("paths", o.Path, strings.ToLower(o.Method)), Checks: !public}
+		switch access := defaultAccess(swagger, operation, public, options.Strategy); {
+		case !public && (m.HasRoles || options.Permissions != nil):
+			// the roles and the permissions replace the strategy
+			m.DefaultRule = &rule
+		case access == accessAuthenticated:
+			rule.Authenticated = true
+			rule.Scopes = scopeAlternatives(swagger, operation)
+			m.DefaultRule = &rule
+		case access == accessAllow:
+			m.DefaultRule = &rule
+		}
+	}
+
+	return m, errs
+}
@@ -0,0 +1,111 @@
+package opa
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildOperationModel(t *testing.T) {
+	swagger := loadTestSpec(t, `
+openapi: 3.0.0
+info: {title: model, version: "1"}
+security: [{oauth: [read:pets]}]
+x-security-rego-role-hierarchy:
+  admin: [editor]
+paths:
+  /pets:
+    get:
+      responses: {"200": {description: ok}}
+    post:
+      x-security-rego-roles: [editor]
+      responses: {"200": {description: ok}}
+    put:
+      x-security-rego-public: true
+      x-security-rego-roles: [editor]
+      responses: {"200": {description: ok}}
+  /pets/{petId}:
+    get:
+      operationId: showPetById
+      x-security-rego-boolean-filter:
+        - rules:
+            - operations:
+                - eq: [$petId, token.payload.sub]
+        - ignore_scopes: true
+          rules:
+            - operations:
+                - eq: [$petId, token.payload.owner]
+      responses: {"200": {description: ok}}
+`)
+
+	tests := []struct {
+		strategy string
+		method   string
+		path     string
+		want     *ruleModel
+	}{
+		{
+			strategy: StrategyAllow, method: "GET", path: "/pets",
+			want: &ruleModel{ID: "#/paths/~1pets/get", Checks: true},
+		},
+		{
+			strategy: StrategyAuthenticated, method: "GET", path: "/pets",
+			want: &ruleModel{ID: "#/paths/~1pets/get", Checks: true, Authenticated: true, Scopes: [][]string{{"read:pets"}}},
+		},
+		{strategy: StrategyDeny, method: "GET", path: "/pets"},
+		{
+			// the roles replace the strategy
+			strategy: StrategyDeny, method: "POST", path: "/pets",
+			want: &ruleModel{ID: "#/paths/~1pets/post", Checks: true},
+		},
+		{
+			// public operations check neither the roles nor the strategy
+			strategy: StrategyAuthenticated, method: "PUT", path: "/pets",
+			want: &ruleModel{ID: "#/paths/~1pets/put"},
+		},
+		{strategy: StrategyAllow, method: "GET", path: "/pets/{petId}"},
+	}
+
+	for _, test := range tests {
+		options := Options{Strategy: test.strategy}
+		spec, errs, err := loadSpecModel(swagger, options)
+		if err != nil || len(errs) > 0 {
+			t.Fatalf("loadSpecModel: %v %v", err, errs)
+		}
+
+		for _, o := range sortedOperations(swagger) {
+			if o.Method != test.method || o.Path != test.path {
+				continue
+			}
+			m, errs := buildOperationModel(swagger, o, spec, options)
+			if len(errs) > 0 {
+				t.Errorf("%v %v: %v", test.method, test.path, errs)
+				continue
+			}
+			if !reflect.DeepEqual(m.DefaultRule, test.want) {
+				t.Errorf("%v %v with the %v strategy: default rule %+v, want %+v", test.method, test.path, test.strategy, m.DefaultRule, test.want)
+			}
+		}
+	}
+
+	spec, _, _ := loadSpecModel(swagger, Options{})
+	for _, o := range sortedOperations(swagger) {
+		m, _ := buildOperationModel(swagger, o, spec, Options{})
+		switch m.ID {
+		case "POST /pets":
+			if !m.HasRoles || !reflect.DeepEqual(m.Roles, []string{"admin", "editor"}) {
+				t.Errorf("roles of %v = %v, want [admin editor]", m.ID, m.Roles)
+			}
+		case "showPetById":
+			if len(m.BooleanFilters) != 2 {
+				t.Fatalf("boolean filters of %v = %+v, want 2", m.ID, m.BooleanFilters)
+			}
+			want := [][]string{{"read:pets"}}
+			if rule := m.BooleanFilters[0][0]; !rule.Checks || !reflect.DeepEqual(rule.Scopes, want) {
+				t.Errorf("rule %+v, want the checks and the scopes %v", rule, want)
+			}
+			if rule := m.BooleanFilters[1][0]; rule.Scopes != nil || rule.ID != "#/paths/~1pets~1{petId}/get/x-security-rego-boolean-filter/1/rules/0" {
+				t.Errorf("rule %+v, want no scopes", rule)
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package opa
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const (
+	// permissionsDocument is the name of the permissions in the data of the package
+	permissionsDocument = "permissions"
+
+	// permittedOp is the operation of the permissions condition in the data tables
+	permittedOp = "permitted"
+)
+
+// Permissions maps roles to the operations they are allowed. They are maintained
+// apart from the spec and generated as data read by the policy, so that changing
+// the permissions does not require generating the policy again.
+type Permissions struct {
+	Roles map[string]RolePermissions `json:"roles"`
+}
+
+// RolePermissions lists the operations a role is allowed by their operationId, by
+// their tags or by the scopes the role grants. An operation is allowed by scopes if
+// they include the scopes of one of its security requirements.
+type RolePermissions struct {
+	Operations []string `json:"operations,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Scopes     []string `json:"scopes,omitempty"`
+}
+
+// permissionsTemplate is the template of the rules reading the roles of the user and
+// checking the permissions of the roles for an operation
+var permissionsTemplate = `
+
+user_roles {{assign}} {role | role := {{.Claim}}[_]}
+
+permitted(roles, operation){{ifkw}} {
+  {{.Ref}}.roles[roles[_]].operations[_] == operation.id
+}
+
+permitted(roles, operation){{ifkw}} {
+  {{.Ref}}.roles[roles[_]].tags[_] == operation.tags[_]
+}
+
+permitted(roles, operation){{ifkw}} {
+  granted := {scope | scope := {{.Ref}}.roles[roles[_]].scopes[_]}
+  scopes := operation.scopes[_]
+  count({scope | scope := scopes[_]} - granted) == 0
+}`
+
+// ValidatePermissions checks that the operations, tags and scopes of the permissions
+// are found in the spec. The errors are located by pointers into the permissions.
+func ValidatePermissions(swagger *openapi3.Swagger, permissions *Permissions) error {
+	operationIDs := map[string]bool{}
+	tags := map[string]bool{}
+	scopes := map[string]bool{}
+	for _, o := range sortedOperations(swagger) {
+		operationIDs[o.Operation.OperationID] = true
+		for _, tag := range o.Operation.Tags {
+			tags[tag] = true
+		}
+		for _, requirement := range securityRequirements(swagger, o.Operation) {
+			for _, schemeScopes := range requirement {
+				for _, scope := range schemeScopes {
+					scopes[scope] = true
+				}
+			}
+		}
+	}
+
+	var errs Errors
+	for _, role := range sortedKeys(permissions.Roles) {
+		p := permissions.Roles[role]
+		for i, operationID := range p.Operations {
+			if operationID == "" || !operationIDs[operationID] {
+				errs.add([]interface{}{"roles", role, "operations", i}, "no operation of the spec has the operationId %q", operationID)
+			}
+		}
+		for i, tag := range p.Tags {
+			if !tags[tag] {
+				errs.add([]interface{}{"roles", role, "tags", i}, "no operation of the spec has the tag %q", tag)
+			}
+		}
+		for i, scope := range p.Scopes {
+			if !scopes[scope] {
+				errs.add([]interface{}{"roles", role, "scopes", i}, "no operation of the spec requires the scope %q", scope)
+			}
+		}
+	}
+	return errs.err()
+}
+
+// permissionsRef returns the ref of the permissions in the data of the package
+func permissionsRef(packageName string) string {
+	return fmt.Sprintf("data.%v.%v", packageName, permissionsDocument)
+}
+
+// permissionsRules returns the rules checking the permissions of the roles of the
+// user, or nothing if the policy is generated without permissions
+func permissionsRules(options Options, funcs template.FuncMap) (string, error) {
+	if options.Permissions == nil {
+		return "", nil
+	}
+
+	claim, err := rolesClaim(options)
+	if err != nil {
+		return "", err
+	}
+	return executeTemplate(permissionsTemplate, funcs, map[string]string{
+		"Claim": claim,
+		"Ref":   permissionsRef(options.PackageName),
+	})
+}
+
+// permittedOperation returns the operation the permissions are checked for, ie. its
+// operationId, its tags and the alternative sets of scopes it requires
+func permittedOperation(swagger *openapi3.Swagger, operation *openapi3.Operation) map[string]interface{} {
+	tags := operation.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	scopes := scopeAlternatives(swagger, operation)
+	if scopes == nil {
+		scopes = [][]string{}
+	}
+	return map[string]interface{}{"id": operation.OperationID, "tags": tags, "scopes": scopes}
+}
+
+// permittedExpression returns the condition of a user whose roles are permitted the operation
+func permittedExpression(swagger *openapi3.Swagger, operation *openapi3.Operation) string {
+	p := permittedOperation(swagger, operation)
+
+	scopes := []string{}
+	for _, alternative := range p["scopes"].([][]string) {
+		scopes = append(scopes, getFormattedMaskFields(alternative))
+	}
+	return fmt.Sprintf(`%v(user_roles, {"id": %q, "tags": %v, "scopes": [%v]})`, permittedOp, p["id"], getFormattedMaskFields(p["tags"].([]string)), strings.Join(scopes, ","))
+}
+
+// permissionsFile returns the data file of the permissions, nested under the package
+func permissionsFile(options Options) (File, error) {
+	data, err := packageData(options.PackageName, map[string]interface{}{permissionsDocument: options.Permissions})
+	if err != nil {
+		return File{}, err
+	}
+	return File{Name: dataFileName, Content: data}, nil
+}
+
+// packageData returns the JSON of the documents nested under the package path so that
+// they are loaded next to the policy
+func packageData(packageName string, documents map[string]interface{}) (string, error) {
+	var tables interface{} = documents
+	packagePath := strings.Split(packageName, ".")
+	for i := len(packagePath) - 1; i >= 0; i-- {
+		tables = map[string]interface{}{packagePath[i]: tables}
+	}
+
+	data, err := json.MarshalIndent(tables, "", "  ")
+	return string(data), err
+}
@@ -0,0 +1,92 @@
+package opa
+
+import (
+	"testing"
+)
+
+func TestValidatePermissions(t *testing.T) {
+	swagger := loadTestSpec(t, `
+openapi: 3.0.0
+info: {title: permissions, version: "1"}
+security: [{oauth: [read:pets]}]
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      tags: [pets]
+      responses: {"200": {description: ok}}
+    post:
+      operationId: createPets
+      tags: [pets, admin]
+      security: [{oauth: [write:pets]}, {key: []}]
+      responses: {"200": {description: ok}}
+  /health:
+    get:
+      responses: {"200": {description: ok}}
+`)
+
+	tests := []struct {
+		name        string
+		permissions Permissions
+		pointers    []string
+	}{
+		{
+			name: "valid",
+			permissions: Permissions{Roles: map[string]RolePermissions{
+				"reader": {Operations: []string{"listPets"}, Scopes: []string{"read:pets"}},
+				"admin":  {Tags: []string{"admin", "pets"}, Scopes: []string{"write:pets"}},
+			}},
+		},
+		{
+			name:        "no roles",
+			permissions: Permissions{},
+		},
+		{
+			name: "unknown operation",
+			permissions: Permissions{Roles: map[string]RolePermissions{
+				"reader": {Operations: []string{"listPets", "deletePets"}},
+			}},
+			pointers: []string{"#/roles/reader/operations/1"},
+		},
+		{
+			name: "operation without operationId",
+			permissions: Permissions{Roles: map[string]RolePermissions{
+				"reader": {Operations: []string{""}},
+			}},
+			pointers: []string{"#/roles/reader/operations/0"},
+		},
+		{
+			name: "unknown tags and scopes of several roles",
+			permissions: Permissions{Roles: map[string]RolePermissions{
+				"writer": {Tags: []string{"store"}, Scopes: []string{"write:pets", "delete:pets"}},
+				"audit":  {Scopes: []string{"audit"}},
+			}},
+			pointers: []string{"#/roles/audit/scopes/0", "#/roles/writer/tags/0", "#/roles/writer/scopes/1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidatePermissions(swagger, &test.permissions)
+			if len(test.pointers) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+
+			errs, ok := err.(Errors)
+			if !ok {
+				t.Fatalf("got %v, want Errors", err)
+			}
+			if len(errs) != len(test.pointers) {
+				t.Fatalf("got errors %v, want %d", errs, len(test.pointers))
+			}
+			for i, e := range errs {
+				if e.Pointer != test.pointers[i] {
+					t.Errorf("got error %v at %v, want %v", e.Message, e.Pointer, test.pointers[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package opa
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const (
+	// DefaultResources is the document below data holding the resource data read by
+	// the data operands if not configured
+	DefaultResources = "resources"
+
+	// dataOperandKey is the key of an operand object referencing the resource data,
+	// eg. {"data": "pets[$petId].owner"}
+	dataOperandKey = "data"
+
+	// dataOperandType is the type of the operands referencing the resource data in
+	// the data tables
+	dataOperandType = "data"
+)
+
+var (
+	// dataParamRE matches the path parameters given in the brackets of a data reference
+	dataParamRE = regexp.MustCompile(`\[\$([^\[\]"]+)\]`)
+
+	// regoIdentifierRE matches the keys of a ref which can follow a dot
+	regoIdentifierRE = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+)
+
+// dataOperand returns the reference of an operand object referencing the resource data
+func dataOperand(operand interface{}) (string, bool) {
+	val, ok := operand.(map[string]interface{})
+	if !ok || len(val) != 1 {
+		return "", false
+	}
+	ref, ok := val[dataOperandKey].(string)
+	return ref, ok
+}
+
+// parseDataRef splits a reference into the resource data, eg. pets[$petId].owner,
+// into its segments. Path parameters are returned as strings starting with "$".
+func parseDataRef(ref string) ([]interface{}, error) {
+	root, path, err := parseRef(dataParamRE.ReplaceAllString(ref, `["$$${1}"]`))
+	if err != nil || strings.HasPrefix(root, pathTemplatePrefix) || root == "_" {
+		return nil, fmt.Errorf("illegal data reference %v", ref)
+	}
+	return append([]interface{}{root}, path...), nil
+}
+
+// operandParams returns the path parameters an operand references, either as a "$"
+// operand or in the brackets of a data reference
+func operandParams(operand interface{}) []string {
+	if val, ok := operand.(string); ok && strings.HasPrefix(val, pathTemplatePrefix) {
+		return []string{strings.TrimLeft(val, pathTemplatePrefix)}
+	}
+
+	params := []string{}
+	ref, ok := dataOperand(operand)
+	if !ok {
+		return params
+	}
+	segments, err := parseDataRef(ref)
+	if err != nil {
+		return params
+	}
+	for _, segment := range segments {
+		if s, ok := segment.(string); ok && strings.HasPrefix(s, pathTemplatePrefix) {
+			params = append(params, strings.TrimLeft(s, pathTemplatePrefix))
+		}
+	}
+	return params
+}
+
+// resourcesRef returns the ref of the document holding the resource data, relative
+// to data unless it starts with "data.", eg. "inventory.resources"
+func resourcesRef(options Options) (string, error) {
+	resources := options.Resources
+	if resources == "" {
+		resources = DefaultResources
+	}
+	ref := resources
+	if !strings.HasPrefix(ref, "data.") {
+		ref = "data." + ref
+	}
+
+	root, path, err := parseRef(ref)
+	if err != nil || root != "data" || len(path) == 0 {
+		return "", fmt.Errorf("illegal resources document %v", options.Resources)
+	}
+	for _, segment := range path {
+		if s, ok := segment.(string); !ok || s == "_" {
+			return "", fmt.Errorf("illegal resources document %v", options.Resources)
+		}
+	}
+	return ref, nil
+}
+
+// checkResources checks that the document holding the resource data does not overlap
+// the package of the policy, which would read its own rules
+func checkResources(ref string, packageName string) error {
+	_, path, _ := parseRef(ref)
+	packagePath := strings.Split(packageName, ".")
+	for i := 0; i < len(path) && i < len(packagePath); i++ {
+		if path[i] != packagePath[i] {
+			return nil
+		}
+	}
+	return fmt.Errorf("resources document %v overlaps the package %v", ref, packageName)
+}
+
+// regoRef renders the segments of a reference as a ref below the base, eg. the
+// resource data. Keys which are not identifiers are quoted, path parameters are
+// variables of the generated rules.
+func regoRef(base string, segments []interface{}) string {
+	ref := base
+	for _, segment := range segments {
+		switch s := segment.(type) {
+		case string:
+			switch {
+			case s == "_":
+				ref += "[_]"
+			case strings.HasPrefix(s, pathTemplatePrefix):
+				ref += fmt.Sprintf("[%v]", strings.TrimLeft(s, pathTemplatePrefix))
+			case regoIdentifierRE.MatchString(s):
+				ref += "." + s
+			default:
+				ref += fmt.Sprintf("[%q]", s)
+			}
+		case float64:
+			ref += fmt.Sprintf("[%v]", strconv.FormatFloat(s, 'f', -1, 64))
+		}
+	}
+	return ref
+}
+
+// resourceRead is a reference into the resource data by the operations of an operation
+type resourceRead struct {
+	Segments  []interface{}
+	Operation string
+}
+
+// resourceReads returns the references into the resource data of the operations of the
+// filters, also by the named conditions they reference, in the order of the operations
+func resourceReads(swagger *openapi3.Swagger, conditions namedConditions) []resourceRead {
+	reads := []resourceRead{}
+	for _, o := range sortedOperations(swagger) {
+		operationID := o.Operation.OperationID
+		if operationID == "" {
+			operationID = fmt.Sprintf("%v %v", o.Method, o.Path)
+		}
+
+		for _, filterOperation := range filterOperations(o.Operation) {
+			for _, op := range sortedKeys(filterOperation) {
+				operations := []operation{{op: filterOperation[op]}}
+				if isReference(op) {
+					name, err := conditions.reference(op, filterOperation[op])
+					if err != nil {
+						continue
+					}
+					operations = conditions[name]
+				}
+
+				for _, referenced := range operations {
+					for _, operands := range referenced {
+						for _, operand := range operands {
+							ref, ok := dataOperand(operand)
+							if !ok {
+								continue
+							}
+							segments, err := parseDataRef(ref)
+							if err == nil {
+								reads = append(reads, resourceRead{Segments: segments, Operation: operationID})
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return reads
+}
+
+// filterOperations returns the operations of the list, overwrite and boolean filters
+// of an operation. Filters which cannot be decoded are skipped.
+func filterOperations(o *openapi3.Operation) []operation {
+	result := []operation{}
+
+	var lists []policySchemaListFilter
+	if val, ok := o.Extensions[oasSecExtRegoListFilter]; ok && unmarshalExtension(val, &lists) == nil {
+		for _, p := range lists {
+			result = append(result, p.Operations...)
+		}
+	}
+
+	var overwrites []policySchemaOverwriteFilter
+	if val, ok := o.Extensions[oasSecExtRegoOverwriteFilter]; ok && unmarshalExtension(val, &overwrites) == nil {
+		for _, p := range overwrites {
+			for _, rule := range p.Rules {
+				result = append(result, rule.Operations...)
+			}
+		}
+	}
+
+	var booleans []policySchemaBooleanFilter
+	if val, ok := o.Extensions[oasSecExtRegoBooleanFilter]; ok && unmarshalExtension(val, &booleans) == nil {
+		for _, p := range booleans {
+			for _, rule := range p.Rules {
+				result = append(result, rule.Operations...)
+			}
+		}
+	}
+	return result
+}
+
+// resourceSchemaDocument is the JSON Schema of the resource data read by a policy
+type resourceSchemaDocument struct {
+	Schema string `json:"$schema"`
+	Title  string `json:"title"`
+	*jsonSchema
+}
+
+// resourceSchema returns the JSON Schema of the layout of the resource data the
+// operations read, nil if they read none. Keys given by path parameters or wildcards
+// are additional properties, numbers index arrays. The values read are described by
+// the operations reading them.
+func resourceSchema(swagger *openapi3.Swagger, options Options) ([]byte, error) {
+	conditions, _ := loadConditions(swagger)
+	reads := resourceReads(swagger, conditions)
+	if len(reads) == 0 {
+		return nil, nil
+	}
+
+	ref, err := resourcesRef(options)
+	if err != nil {
+		return nil, err
+	}
+	packageName := options.PackageName
+	if packageName == "" {
+		packageName = DefaultPackageName
+	}
+	err = checkResources(ref, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &jsonSchema{Type: "object", Description: fmt.Sprintf("Resource data the policy reads from %v", ref)}
+	readers := map[*jsonSchema]map[string]bool{}
+	for _, read := range reads {
+		node := root
+		for _, segment := range read.Segments {
+			node = childSchema(node, segment)
+		}
+		if readers[node] == nil {
+			readers[node] = map[string]bool{}
+		}
+		readers[node][read.Operation] = true
+	}
+	for node, operations := range readers {
+		node.Description = "Read by " + strings.Join(sortedKeys(operations), ", ")
+	}
+
+	return json.MarshalIndent(resourceSchemaDocument{
+		Schema:     jsonSchemaDraft,
+		Title:      fmt.Sprintf("%v resource data", swagger.Info.Title),
+		jsonSchema: root,
+	}, "", "  ")
+}
+
+// childSchema returns the schema of the value below the segment of a data reference,
+// adding it to the schema of the parent value
+func childSchema(node *jsonSchema, segment interface{}) *jsonSchema {
+	switch s := segment.(type) {
+	case float64:
+		addSchemaType(node, "array")
+		if node.Items == nil {
+			node.Items = &jsonSchema{}
+		}
+		return node.Items
+	case string:
+		addSchemaType(node, "object")
+		if s == "_" || strings.HasPrefix(s, pathTemplatePrefix) {
+			additional, ok := node.AdditionalProperties.(*jsonSchema)
+			if !ok {
+				additional = &jsonSchema{}
+				node.AdditionalProperties = additional
+			}
+			return additional
+		}
+
+		if node.Properties == nil {
+			node.Properties = map[string]*jsonSchema{}
+		}
+		child, ok := node.Properties[s]
+		if !ok {
+			child = &jsonSchema{}
+			node.Properties[s] = child
+			node.Required = append(node.Required, s)
+			sort.Strings(node.Required)
+		}
+		return child
+	}
+	return node
+}
+
+// addSchemaType adds a type to the types of the schema
+func addSchemaType(schema *jsonSchema, t string) {
+	switch types := schema.Type.(type) {
+	case nil:
+		schema.Type = t
+	case string:
+		if types != t {
+			schema.Type = []string{types, t}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package opa
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegoOperandData(t *testing.T) {
+	tests := []struct {
+		ref       string
+		op        string
+		extension string
+		resources string
+		want      string
+	}{
+		{ref: "pets[$petId].owner", op: "eq", want: "data.resources.pets[petId].owner"},
+		{ref: "pets[$petId].vets", op: "membership", want: "data.resources.pets[petId].vets[_]"},
+		{ref: "pets[$petId].blocked", op: "negation", want: "not data.resources.pets[petId].blocked"},
+		{ref: "pets[$petId].blocked", op: "negation", extension: oasSecExtRegoListFilter, want: "data.resources.pets[petId].blocked"},
+		{ref: "pets[_].owner", op: "eq", want: "data.resources.pets[_].owner"},
+		{ref: `owners["a b"][0]`, op: "eq", want: `data.resources.owners["a b"][0]`},
+		{ref: "owners[$ownerId].pets[$petId]", op: "eq", want: "data.resources.owners[ownerId].pets[petId]"},
+		{ref: "pets[$petId].owner", op: "eq", resources: "data.inventory.resources", want: "data.inventory.resources.pets[petId].owner"},
+		{ref: "$petId", op: "eq"},
+		{ref: "_", op: "eq"},
+		{ref: "pets[$petId", op: "eq"},
+		{ref: "", op: "eq"},
+	}
+
+	for _, test := range tests {
+		extension := test.extension
+		if extension == "" {
+			extension = oasSecExtRegoBooleanFilter
+		}
+		resources := test.resources
+		if resources == "" {
+			resources = "data." + DefaultResources
+		}
+
+		got, err := regoOperand(map[string]interface{}{dataOperandKey: test.ref}, test.op, extension, defaultInputFields, resources)
+		switch {
+		case test.want == "" && err == nil:
+			t.Errorf("%v: got %v, want an error", test.ref, got)
+		case test.want != "" && err != nil:
+			t.Errorf("%v: %v", test.ref, err)
+		case got != test.want:
+			t.Errorf("%v: got %v, want %v", test.ref, got, test.want)
+		}
+	}
+}
+
+func TestResourceSchema(t *testing.T) {
+	swagger := loadTestSpec(t, `
+openapi: 3.0.0
+info: {title: pets, version: "1"}
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      x-security-rego-list-filter:
+        - source: list
+          operations:
+            - lt: [age, {data: "settings.limits[0]"}]
+      responses: {"200": {description: ok}}
+  /pets/{petId}:
+    get:
+      operationId: showPetById
+      x-security-rego-boolean-filter:
+        - rules:
+            - operations:
+                - eq: [{data: "pets[$petId].owner"}, token.payload.sub]
+            - operations:
+                - condition: vet
+      responses: {"200": {description: ok}}
+    delete:
+      operationId: deletePet
+      x-security-rego-boolean-filter:
+        - rules:
+            - operations:
+                - eq: [{data: "pets[$petId].owner"}, token.payload.sub]
+      responses: {"200": {description: ok}}
+components:
+  x-security-rego-conditions:
+    vet:
+      - membership: [token.payload.sub, {data: "pets[$petId].vets"}]
+`)
+
+	result, err := NewGenerator().Generate(swagger)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	checkRegoFiles(t, result.Files)
+	for _, want := range []string{"data.resources.pets[petId].owner = token.payload.sub", "token.payload.sub[_] = data.resources.pets[petId].vets[_]", "x.age < data.resources.settings.limits[0]"} {
+		if !strings.Contains(result.Files[0].Content, want) {
+			t.Errorf("policy does not contain %v:\n%v", want, result.Files[0].Content)
+		}
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(result.ResourceSchema, &got); err != nil {
+		t.Fatalf("resource schema %s: %v", result.ResourceSchema, err)
+	}
+	delete(got, "$schema")
+
+	var want map[string]interface{}
+	err = json.Unmarshal([]byte(`{
+  "title": "pets resource data",
+  "type": "object",
+  "description": "Resource data the policy reads from data.resources",
+  "properties": {
+    "pets": {
+      "type": "object",
+      "additionalProperties": {
+        "type": "object",
+        "properties": {
+          "owner": {"description": "Read by deletePet, showPetById"},
+          "vets": {"description": "Read by showPetById"}
+        },
+        "required": ["owner", "vets"]
+      }
+    },
+    "settings": {
+      "type": "object",
+      "properties": {
+        "limits": {"type": "array", "items": {"description": "Read by listPets"}}
+      },
+      "required": ["limits"]
+    }
+  },
+  "required": ["pets", "settings"]
+}`), &want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resource schema %s, want %v", result.ResourceSchema, want)
+	}
+
+	// policies reading no resource data have no schema
+	result, err = NewGenerator().Generate(loadTestSpec(t, testPetstore))
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if result.ResourceSchema != nil {
+		t.Errorf("resource schema %s, want none", result.ResourceSchema)
+	}
+}
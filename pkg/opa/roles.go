@@ -0,0 +1,139 @@
+package opa
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const (
+	// OAS Extension to allow an operation to the roles listed
+	oasSecExtRegoRoles = "x-security-rego-roles"
+
+	// OAS Extension of the document defining the roles each role inherits
+	oasSecExtRegoRoleHierarchy = "x-security-rego-role-hierarchy"
+
+	// DefaultRolesClaim is the claim of the token payload holding the roles if not configured
+	DefaultRolesClaim = "roles"
+
+	// rolesOp is the operation of the roles condition in the data tables
+	rolesOp = "roles"
+)
+
+var (
+	// rolesExpressionRE matches a roles condition, the claim and the quoted roles
+	rolesExpressionRE = regexp.MustCompile(`^count\(\{role \| role := (.+)\[_\]\} & \{(.+)\}\) > 0$`)
+	quotedStringRE    = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+)
+
+// roleHierarchy maps a role to the roles it inherits, ie. a role is allowed
+// everything the roles it inherits are allowed
+type roleHierarchy map[string][]string
+
+// loadRoleHierarchy reads the role hierarchy of the spec, if any
+func loadRoleHierarchy(swagger *openapi3.Swagger) (roleHierarchy, error) {
+	hierarchy := roleHierarchy{}
+	val, ok := swagger.Extensions[oasSecExtRegoRoleHierarchy]
+	if !ok {
+		return hierarchy, nil
+	}
+
+	err := unmarshalExtension(val, &hierarchy)
+	return hierarchy, err
+}
+
+// allowed returns the roles and the roles inheriting one of them, directly or
+// through other roles, sorted so that the generated policy is deterministic
+func (h roleHierarchy) allowed(roles []string) []string {
+	result := map[string]bool{}
+	for _, role := range roles {
+		result[role] = true
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for role, inherited := range h {
+			if result[role] {
+				continue
+			}
+			for _, r := range inherited {
+				if result[r] {
+					result[role] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return sortedKeys(result)
+}
+
+// operationRoles returns the roles allowed to the operation by the extension and
+// the hierarchy, and whether the operation has the extension
+func operationRoles(operation *openapi3.Operation, hierarchy roleHierarchy) ([]string, bool, error) {
+	val, ok := operation.Extensions[oasSecExtRegoRoles]
+	if !ok {
+		return nil, false, nil
+	}
+
+	var roles []string
+	err := unmarshalExtension(val, &roles)
+	if err != nil {
+		return nil, true, err
+	}
+	if len(roles) == 0 {
+		return nil, true, fmt.Errorf("no roles are allowed to the operation")
+	}
+	return hierarchy.allowed(roles), true, nil
+}
+
+// rolesClaim returns the ref of the claim holding the roles. Claims are relative to
+// the token payload unless they start with "token.", eg. "realm_access.roles".
+func rolesClaim(options Options) (string, error) {
+	claim := options.RolesClaim
+	if claim == "" {
+		claim = DefaultRolesClaim
+	}
+	if !strings.HasPrefix(claim, tokenPrefix+".") {
+		claim = fmt.Sprintf("%v.payload.%v", tokenPrefix, claim)
+	}
+
+	_, _, err := parseRef(claim)
+	if err != nil {
+		return "", fmt.Errorf("illegal roles claim %v", options.RolesClaim)
+	}
+	return claim, nil
+}
+
+// rolesExpression returns the condition of a token with one of the roles, ie. the
+// intersection of the roles of the claim and the allowed roles is not empty
+func rolesExpression(claim string, roles []string) string {
+	quoted := make([]string, len(roles))
+	for i, role := range roles {
+		quoted[i] = strconv.Quote(role)
+	}
+	return fmt.Sprintf("count({role | role := %v[_]} & {%v}) > 0", claim, strings.Join(quoted, ", "))
+}
+
+// rolesOfExpression returns the roles of a roles condition and its claim
+func rolesOfExpression(expr string) ([]string, string, bool) {
+	match := rolesExpressionRE.FindStringSubmatch(expr)
+	if match == nil {
+		return nil, "", false
+	}
+
+	roles := []string{}
+	for _, quoted := range quotedStringRE.FindAllString(match[2], -1) {
+		role, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, "", false
+		}
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles, match[1], len(roles) > 0
+}
@@ -0,0 +1,103 @@
+package opa
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoleHierarchyAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		hierarchy roleHierarchy
+		roles     []string
+		want      []string
+	}{
+		{
+			name:  "no hierarchy",
+			roles: []string{"viewer", "editor"},
+			want:  []string{"editor", "viewer"},
+		},
+		{
+			name:      "inheriting role",
+			hierarchy: roleHierarchy{"editor": {"viewer"}},
+			roles:     []string{"viewer"},
+			want:      []string{"editor", "viewer"},
+		},
+		{
+			name:      "inherited role",
+			hierarchy: roleHierarchy{"editor": {"viewer"}},
+			roles:     []string{"editor"},
+			want:      []string{"editor"},
+		},
+		{
+			name:      "transitive",
+			hierarchy: roleHierarchy{"admin": {"editor"}, "editor": {"viewer"}, "owner": {"admin"}},
+			roles:     []string{"viewer"},
+			want:      []string{"admin", "editor", "owner", "viewer"},
+		},
+		{
+			name:      "several inherited roles",
+			hierarchy: roleHierarchy{"admin": {"auditor", "editor"}, "editor": {"viewer"}},
+			roles:     []string{"auditor"},
+			want:      []string{"admin", "auditor"},
+		},
+		{
+			name:      "cycle",
+			hierarchy: roleHierarchy{"a": {"b"}, "b": {"c"}, "c": {"a"}},
+			roles:     []string{"b"},
+			want:      []string{"a", "b", "c"},
+		},
+		{
+			name:      "role inheriting itself",
+			hierarchy: roleHierarchy{"editor": {"editor", "viewer"}},
+			roles:     []string{"viewer"},
+			want:      []string{"editor", "viewer"},
+		},
+		{
+			name:      "unrelated roles",
+			hierarchy: roleHierarchy{"admin": {"editor"}},
+			roles:     []string{"viewer"},
+			want:      []string{"viewer"},
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.hierarchy.allowed(test.roles); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: allowed(%v) = %v, want %v", test.name, test.roles, got, test.want)
+		}
+	}
+}
+
+func TestRoleHierarchyPolicy(t *testing.T) {
+	swagger := loadTestSpec(t, `
+openapi: 3.0.0
+info: {title: roles, version: "1"}
+x-security-rego-role-hierarchy:
+  admin: [editor]
+  editor: [viewer]
+  viewer: [admin]
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      x-security-rego-roles: [viewer]
+      responses: {"200": {description: ok}}
+`)
+
+	result, err := NewGenerator().Generate(swagger)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	modules := checkRegoFiles(t, result.Files)
+	if len(modules) == 0 {
+		t.Fatalf("no files generated")
+	}
+
+	want := rolesExpression("token.payload.roles", []string{"admin", "editor", "viewer"})
+	for _, file := range result.Files {
+		if !strings.Contains(file.Content, want) {
+			t.Errorf("%v does not contain %v:\n%v", file.Name, want, file.Content)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package opa
+
+import (
+	"path"
+	"strings"
+)
+
+const (
+	// DefaultBundlePath is the path OPA loads the bundle from if not configured
+	DefaultBundlePath = "/bundles/bundle.tar.gz"
+
+	// runtimeConfigFileName is the name of the OPA configuration file
+	runtimeConfigFileName = "config.yaml"
+
+	// composeFileName is the name of the docker-compose snippet running OPA
+	composeFileName = "docker-compose.yaml"
+
+	// sidecarFileName is the name of the Kubernetes snippet running OPA as a sidecar
+	sidecarFileName = "opa-sidecar.yaml"
+)
+
+// RuntimeConfig configures the OPA runtime files
+type RuntimeConfig struct {
+	// BundlePath is the local path OPA loads the bundle from, DefaultBundlePath if not set
+	BundlePath string
+
+	// BundleFile is the bundle file mounted into the container at the bundle path,
+	// relative to the runtime files
+	BundleFile string
+}
+
+// runtimeConfigTemplate is the template of the OPA configuration. The bundle is
+// loaded from disk and reloaded when it changes.
+var runtimeConfigTemplate = `# OPA configuration loading the {{.PackageName}} policy
+bundles:
+  {{.PackageName}}:
+    resource: file://{{.BundlePath}}
+    polling:
+      min_delay_seconds: 10
+      max_delay_seconds: 20
+default_decision: /{{.DecisionPath}}
+decision_logs:
+  console: true
+status:
+  console: true
+{{- if .Envoy}}
+plugins:
+  envoy_ext_authz_grpc:
+    addr: :9191
+    path: {{.DecisionPath}}
+{{- end}}
+`
+
+// composeTemplate is the template of the docker-compose service running OPA with
+// the configuration and the bundle mounted
+var composeTemplate = `# Add the opa service to the docker-compose file of the service
+services:
+  opa:
+    image: {{.Image}}
+    command:
+      - run
+      - --server
+      - --addr=0.0.0.0:8181
+      - --config-file=/config/config.yaml
+    ports:
+      - "8181:8181"
+{{- if .Envoy}}
+      - "9191:9191"
+{{- end}}
+    volumes:
+      - ./config.yaml:/config/config.yaml:ro
+      - {{.BundleFile}}:{{.BundlePath}}:ro
+`
+
+// sidecarTemplate is the template of the Kubernetes ConfigMap with the configuration
+// and the container and volumes running OPA as a sidecar
+var sidecarTemplate = `# ConfigMap with the OPA configuration. The bundle is expected in the opa-bundle
+# ConfigMap, create it in the directory of this file with:
+#   kubectl create configmap opa-bundle --from-file={{.BundleName}}={{.BundleFile}}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: opa-config
+data:
+  config.yaml: |
+{{.IndentedConfig}}
+---
+# Add the container and the volumes to the pod spec of the service
+containers:
+  - name: opa
+    image: {{.Image}}
+    args:
+      - run
+      - --server
+      - --addr=0.0.0.0:8181
+      - --config-file=/config/config.yaml
+    ports:
+      - containerPort: 8181
+{{- if .Envoy}}
+      - containerPort: 9191
+{{- end}}
+    volumeMounts:
+      - name: opa-config
+        mountPath: /config
+        readOnly: true
+      - name: opa-bundle
+        mountPath: {{.BundleDir}}
+        readOnly: true
+    readinessProbe:
+      httpGet:
+        path: /health?bundles
+        port: 8181
+    livenessProbe:
+      httpGet:
+        path: /health
+        port: 8181
+volumes:
+  - name: opa-config
+    configMap:
+      name: opa-config
+  - name: opa-bundle
+    configMap:
+      name: opa-bundle
+`
+
+// runtime holds the values of the runtime file templates
+type runtime struct {
+	PackageName    string
+	DecisionPath   string
+	BundlePath     string
+	BundleDir      string
+	BundleName     string
+	BundleFile     string
+	Image          string
+	Envoy          bool
+	IndentedConfig string
+}
+
+// GenerateRuntimeFiles generates the OPA configuration loading the bundle of the
+// policy generated with the options, a docker-compose service and a Kubernetes
+// sidecar snippet running OPA with it. The decision path is the rule the target
+// queries, ie. "result" for Envoy and "decision" or "allow" otherwise.
+func GenerateRuntimeFiles(options Options, config RuntimeConfig) ([]File, error) {
+	r := runtime{
+		PackageName: options.PackageName,
+		BundlePath:  config.BundlePath,
+		BundleFile:  config.BundleFile,
+		Image:       "openpolicyagent/opa:latest",
+		Envoy:       options.Target == TargetEnvoy,
+	}
+	if r.BundlePath == "" {
+		r.BundlePath = DefaultBundlePath
+	}
+	if r.BundleFile == "" {
+		r.BundleFile = "./" + path.Base(r.BundlePath)
+	}
+	r.BundleDir, r.BundleName = path.Dir(r.BundlePath), path.Base(r.BundlePath)
+
+	rule := "allow"
+	switch {
+	case r.Envoy:
+		rule = "result"
+		r.Image = "openpolicyagent/opa:latest-envoy"
+	case options.Decision:
+		rule = "decision"
+	}
+	r.DecisionPath = path.Join(strings.Replace(options.PackageName, ".", "/", -1), rule)
+
+	runtimeConfig, err := executeTemplate(runtimeConfigTemplate, nil, r)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSuffix(runtimeConfig, "\n"), "\n")
+	r.IndentedConfig = "    " + strings.Join(lines, "\n    ")
+
+	compose, err := executeTemplate(composeTemplate, nil, r)
+	if err != nil {
+		return nil, err
+	}
+	sidecar, err := executeTemplate(sidecarTemplate, nil, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return []File{
+		{Name: runtimeConfigFileName, Content: runtimeConfig},
+		{Name: composeFileName, Content: compose},
+		{Name: sidecarFileName, Content: sidecar},
+	}, nil
+}
@@ -0,0 +1,81 @@
+package opa
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+func TestGenerateRuntimeFiles(t *testing.T) {
+	swagger := loadTestSpec(t, testPetstore)
+
+	tests := []struct {
+		opts []Option
+		rule string
+	}{
+		{rule: "allow"},
+		{opts: []Option{WithDecision(true)}, rule: "decision"},
+		{opts: []Option{WithLayout(LayoutTag), WithDecision(true)}, rule: "decision"},
+		{opts: []Option{WithTarget(TargetEnvoy)}, rule: "result"},
+		{opts: []Option{WithTarget(TargetEnvoy), WithMode(ModeData)}, rule: "result"},
+	}
+
+	for _, test := range tests {
+		generator := NewGenerator(append([]Option{WithPackageName("example.authz")}, test.opts...)...)
+		options := generator.Options()
+		result, err := generator.Generate(swagger)
+		if err != nil {
+			t.Fatalf("%+v: %v", options, err)
+		}
+		files, err := GenerateRuntimeFiles(options, RuntimeConfig{})
+		if err != nil {
+			t.Fatalf("%+v: GenerateRuntimeFiles: %v", options, err)
+		}
+
+		var config struct {
+			Bundles         map[string]struct{ Resource string }
+			DefaultDecision string `json:"default_decision"`
+			Plugins         struct {
+				Envoy *struct{ Path string } `json:"envoy_ext_authz_grpc"`
+			}
+		}
+		for _, file := range files {
+			for _, document := range strings.Split(file.Content, "\n---\n") {
+				var v interface{}
+				if err := yaml.Unmarshal([]byte(document), &v); err != nil {
+					t.Errorf("%+v: %v: %v", options, file.Name, err)
+				}
+			}
+			if file.Name == runtimeConfigFileName {
+				if err := yaml.Unmarshal([]byte(file.Content), &config); err != nil {
+					t.Fatalf("%+v: %v: %v", options, file.Name, err)
+				}
+			}
+		}
+
+		// the decision the runtime queries is a rule of the checked root policy
+		if expected := "/example/authz/" + test.rule; config.DefaultDecision != expected {
+			t.Errorf("%+v: default decision %v, want %v", options, config.DefaultDecision, expected)
+		}
+		if bundle := config.Bundles["example.authz"]; bundle.Resource != "file://"+DefaultBundlePath {
+			t.Errorf("%+v: bundle resource %v, want file://%v", options, bundle.Resource, DefaultBundlePath)
+		}
+		if envoy := options.Target == TargetEnvoy; envoy != (config.Plugins.Envoy != nil) ||
+			envoy && config.Plugins.Envoy.Path != "example/authz/result" {
+			t.Errorf("%+v: Envoy plugin %+v", options, config.Plugins.Envoy)
+		}
+
+		module := checkRegoFiles(t, result.Files)[policyFileName]
+		if module == nil {
+			t.Fatalf("%+v: no %v generated", options, policyFileName)
+		}
+		defined := false
+		for _, rule := range module.Rules {
+			defined = defined || rule.Name == test.rule
+		}
+		if !defined {
+			t.Errorf("%+v: the policy does not define the decision %v", options, test.rule)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package opa
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	toolName     = "openapi-to-rego"
+)
+
+// sarifLog defines the subset of a SARIF log written for the lint problems
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+// WriteSARIF writes the problems found in the spec file as a SARIF log to w. Problems
+// are located by their line, if set, and their pointer.
+func WriteSARIF(w io.Writer, specFile string, problems []Problem) error {
+	kinds := make([]string, 0, len(ProblemDescriptions))
+	for kind := range ProblemDescriptions {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	rules := make([]sarifRule, len(kinds))
+	for i, kind := range kinds {
+		rules[i] = sarifRule{ID: kind, ShortDescription: sarifMessage{Text: ProblemDescriptions[kind]}}
+	}
+
+	results := make([]sarifResult, len(problems))
+	for i, problem := range problems {
+		location := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: specFile}}
+		if problem.Line > 0 {
+			location.Region = &sarifRegion{StartLine: problem.Line}
+		}
+		results[i] = sarifResult{
+			RuleID:  problem.Kind,
+			Level:   problem.Severity,
+			Message: sarifMessage{Text: problem.Message},
+			Locations: []sarifLocation{{
+				PhysicalLocation: location,
+				LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: problem.Pointer}},
+			}},
+		}
+	}
+
+	log := sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: sarifDriver{Name: toolName, Rules: rules}},
+			Results: results,
+		}},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
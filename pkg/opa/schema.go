@@ -0,0 +1,345 @@
+package opa
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// jsonSchema is the subset of JSON Schema used to describe the OpenAPI extensions.
+// KeyName and ItemName name the keys and items of an instance in the problems
+// reported when validating it.
+type jsonSchema struct {
+	Type                 interface{}            `json:"type,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	MinProperties        *int                   `json:"minProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+
+	KeyName  string `json:"-"`
+	ItemName string `json:"-"`
+}
+
+// operandCounts defines the number of operands of each operation
+var operandCounts = map[string]int{
+	"eq":         2,
+	"lt":         2,
+	"gte":        2,
+	"membership": 2,
+	"negation":   1,
+}
+
+// extensionTypes defines the Go type the value of each OpenAPI extension is decoded into
+var extensionTypes = map[string]reflect.Type{
+	oasSecExtRegoFieldFilter:     reflect.TypeOf([]extensionDefinition{}),
+	oasSecExtRegoListFilter:      reflect.TypeOf([]policySchemaListFilter{}),
+	oasSecExtRegoOverwriteFilter: reflect.TypeOf([]policySchemaOverwriteFilter{}),
+	oasSecExtRegoBooleanFilter:   reflect.TypeOf([]policySchemaBooleanFilter{}),
+	oasSecExtRegoPublic:          reflect.TypeOf(true),
+	oasSecExtRegoRoles:           reflect.TypeOf([]string{}),
+	oasSecExtRegoMerge:           reflect.TypeOf([]string{}),
+	oasSecExtRegoTenantExempt:    reflect.TypeOf(true),
+}
+
+// documentExtensionTypes defines the Go type the value of each OpenAPI extension only
+// defined by the document is decoded into. The document, the tags and the path items
+// define the extensions of the operations as well, which they inherit.
+var documentExtensionTypes = map[string]reflect.Type{
+	oasSecExtRegoRoleHierarchy: reflect.TypeOf(roleHierarchy{}),
+	oasSecExtRegoTenant:        reflect.TypeOf(tenantIsolation{}),
+}
+
+// componentExtensionTypes defines the Go type the value of each OpenAPI extension of
+// the components is decoded into
+var componentExtensionTypes = map[string]reflect.Type{
+	oasSecExtRegoConditions: reflect.TypeOf(namedConditions{}),
+}
+
+// extensionDescriptions describes each OpenAPI extension
+var extensionDescriptions = map[string]string{
+	oasSecExtRegoFieldFilter:     "Fields of the response object to filter per security scheme of the operation",
+	oasSecExtRegoListFilter:      "Filters of the list of objects in the input",
+	oasSecExtRegoOverwriteFilter: "Overwrites of a field of the response object",
+	oasSecExtRegoBooleanFilter:   "Rules allowing the operation",
+	oasSecExtRegoPublic:          "Allow the operation without conditions whatever the strategy",
+	oasSecExtRegoRoles:           "Roles of which the user needs one, or a role inheriting it, to be allowed the operation",
+	oasSecExtRegoRoleHierarchy:   "Roles inherited by each role of the document",
+	oasSecExtRegoMerge:           "Extensions of the object whose items are appended to the inherited items instead of replacing them",
+	oasSecExtRegoConditions:      "Named conditions, ie. operations of which all need to be satisfied, referenced by the operations of the extensions",
+	oasSecExtRegoTenant:          "Where the tenant of the user and the tenant of the requests are found, every operation requires them to be equal",
+	oasSecExtRegoTenantExempt:    "Do not require the tenant of the request to be the tenant of the user",
+}
+
+// extensionSchemas defines the schema of the value of each OpenAPI extension. The
+// schemas are generated from the Go types so that they cannot diverge.
+var (
+	extensionSchemas          = buildExtensionSchemas(extensionTypes)
+	documentExtensionSchemas  = buildExtensionSchemas(documentExtensionTypes, extensionTypes)
+	componentExtensionSchemas = buildExtensionSchemas(componentExtensionTypes)
+)
+
+func buildExtensionSchemas(types ...map[string]reflect.Type) map[string]*jsonSchema {
+	schemas := map[string]*jsonSchema{}
+	for _, m := range types {
+		for name, t := range m {
+			schema := typeSchema(t)
+			schema.Description = extensionDescriptions[name]
+			schemas[name] = schema
+		}
+	}
+	return schemas
+}
+
+// typeSchema returns the schema of the JSON decoded into a value of the Go type.
+// Struct fields are described by their "json", "required" and "description" tags.
+func typeSchema(t reflect.Type) *jsonSchema {
+	switch t {
+	case reflect.TypeOf(operation{}):
+		return operatorSchema()
+	case reflect.TypeOf(extensionDefinition{}):
+		return &jsonSchema{
+			Type:                 "object",
+			MinProperties:        intPtr(1),
+			AdditionalProperties: typeSchema(t.Elem()),
+			KeyName:              "security scheme",
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.Slice:
+		return &jsonSchema{Type: "array", Items: typeSchema(t.Elem())}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: typeSchema(t.Elem())}
+	case reflect.Struct:
+		schema := &jsonSchema{
+			Type:                 "object",
+			Properties:           map[string]*jsonSchema{},
+			AdditionalProperties: false,
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+
+			property := typeSchema(field.Type)
+			property.Description = field.Tag.Get("description")
+			schema.Properties[name] = property
+			if field.Tag.Get("required") == "true" {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		return schema
+	default:
+		// any JSON value
+		return &jsonSchema{}
+	}
+}
+
+// operatorSchema returns the schema of an operation, ie. an object with an operator
+// as key and the operands as value, or a reference to a named condition
+func operatorSchema() *jsonSchema {
+	properties := map[string]*jsonSchema{
+		refOp:       {Type: "string", Description: "Pointer to a named condition of the components"},
+		conditionOp: {Type: "string", Description: "Name of a named condition of the components"},
+	}
+	for op, count := range operandCounts {
+		properties[op] = &jsonSchema{
+			Type:     "array",
+			Items:    operandSchema(),
+			MinItems: intPtr(count),
+			MaxItems: intPtr(count),
+			ItemName: "operand",
+		}
+	}
+
+	return &jsonSchema{
+		Type:                 "object",
+		Properties:           properties,
+		AdditionalProperties: false,
+		KeyName:              "operator",
+	}
+}
+
+// operandSchema returns the schema of an operand, a string, a boolean, a number or an
+// object referencing the resource data
+func operandSchema() *jsonSchema {
+	return &jsonSchema{
+		Type: []string{"string", "boolean", "number", "object"},
+		Properties: map[string]*jsonSchema{
+			dataOperandKey: {Type: "string", Description: "Reference into the resource data, eg. pets[$petId].owner"},
+		},
+		AdditionalProperties: false,
+		Required:             []string{dataOperandKey},
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+const (
+	// SchemaVersion is the version of the x-security-rego extension vocabulary. The
+	// major version changes when specs valid before are no longer accepted.
+	SchemaVersion = "1.7.0"
+
+	jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+	schemaID        = "urn:openapi-to-rego:x-security-rego:" + SchemaVersion
+)
+
+// schemaDocument is the JSON Schema published for the OpenAPI extensions
+type schemaDocument struct {
+	Schema      string                 `json:"$schema"`
+	ID          string                 `json:"$id"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description"`
+	Version     string                 `json:"version"`
+	Type        string                 `json:"type"`
+	Properties  map[string]*jsonSchema `json:"properties"`
+	Definitions map[string]*jsonSchema `json:"definitions"`
+}
+
+// Schema returns the JSON Schema of the x-security-rego extensions. It validates
+// an OpenAPI operation object, the schema of each extension is found under its name
+// in the properties. Path items and tags define the same extensions. The extensions
+// of the document and of the components are found in the definitions.
+func Schema() ([]byte, error) {
+	document := schemaDocument{
+		Schema:      jsonSchemaDraft,
+		ID:          schemaID,
+		Title:       "x-security-rego extensions",
+		Description: "OpenAPI extensions of an operation to generate a Rego policy from",
+		Version:     SchemaVersion,
+		Type:        "object",
+		Properties:  extensionSchemas,
+		Definitions: map[string]*jsonSchema{
+			"document": {
+				Type:        "object",
+				Description: "OpenAPI extensions of the document, the extensions of the operations are inherited by them",
+				Properties:  documentExtensionSchemas,
+			},
+			"components": {
+				Type:        "object",
+				Description: "OpenAPI extensions of the components object",
+				Properties:  componentExtensionSchemas,
+			},
+		},
+	}
+	return json.MarshalIndent(document, "", "  ")
+}
+
+// validate validates the value against the schema and returns the problems found.
+// The pointer locates the value in the OpenAPI spec.
+func (s *jsonSchema) validate(value interface{}, pointer []interface{}) []Problem {
+	problems := []Problem{}
+
+	if !s.hasType(value) {
+		return append(problems, newProblem(ProblemInvalidType, pointer, "expected %v, got %v", s.Type, jsonType(value)))
+	}
+
+	switch val := value.(type) {
+	case []interface{}:
+		name := s.ItemName
+		if name == "" {
+			name = "item"
+		}
+		if s.MinItems != nil && s.MaxItems != nil && *s.MinItems == *s.MaxItems && len(val) != *s.MinItems {
+			problems = append(problems, newProblem(ProblemOperandCount, pointer, "expected %d %v(s), got %d", *s.MinItems, name, len(val)))
+		} else if s.MinItems != nil && len(val) < *s.MinItems {
+			problems = append(problems, newProblem(ProblemOperandCount, pointer, "expected at least %d %v(s), got %d", *s.MinItems, name, len(val)))
+		} else if s.MaxItems != nil && len(val) > *s.MaxItems {
+			problems = append(problems, newProblem(ProblemOperandCount, pointer, "expected at most %d %v(s), got %d", *s.MaxItems, name, len(val)))
+		}
+
+		if s.Items != nil {
+			for i, item := range val {
+				problems = append(problems, s.Items.validate(item, pointerAt(pointer, i))...)
+			}
+		}
+	case map[string]interface{}:
+		name := s.KeyName
+		if name == "" {
+			name = "key"
+		}
+		for _, key := range s.Required {
+			if _, ok := val[key]; !ok {
+				problems = append(problems, newProblem(ProblemMissingKey, pointer, "missing %v %q", name, key))
+			}
+		}
+		if s.MinProperties != nil && len(val) < *s.MinProperties {
+			problems = append(problems, newProblem(ProblemMissingKey, pointer, "expected at least %d %v(s)", *s.MinProperties, name))
+		}
+
+		for _, key := range sortedKeys(val) {
+			if property, ok := s.Properties[key]; ok {
+				problems = append(problems, property.validate(val[key], pointerAt(pointer, key))...)
+				continue
+			}
+
+			switch additional := s.AdditionalProperties.(type) {
+			case *jsonSchema:
+				problems = append(problems, additional.validate(val[key], pointerAt(pointer, key))...)
+			case bool:
+				kind := ProblemUnknownKey
+				if name == "operator" {
+					kind = ProblemUnknownOperator
+				}
+				problems = append(problems, newProblem(kind, pointerAt(pointer, key), "unknown %v %q", name, key))
+			}
+		}
+	}
+	return problems
+}
+
+// hasType returns whether the value has one of the types of the schema
+func (s *jsonSchema) hasType(value interface{}) bool {
+	var types []string
+	switch t := s.Type.(type) {
+	case string:
+		types = []string{t}
+	case []string:
+		types = t
+	default:
+		return true
+	}
+
+	actual := jsonType(value)
+	for _, t := range types {
+		if t == actual {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON Schema type of a value decoded from JSON
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -0,0 +1,92 @@
+package opa
+
+import (
+	"fmt"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const (
+	// StrategyAllow allows the operations without a boolean filter
+	StrategyAllow = "allow"
+
+	// StrategyAuthenticated allows the operations without a boolean filter if the
+	// request has a token with the scopes of one of the security requirements of the
+	// operation, unless the operation has no security requirements. Like all rules,
+	// it decodes the token without verifying its signature, eg. left to a gateway.
+	StrategyAuthenticated = "authenticated"
+
+	// StrategyDeny denies the operations without a boolean filter
+	StrategyDeny = "deny"
+
+	// OAS Extension to allow an operation without conditions whatever the strategy
+	oasSecExtRegoPublic = "x-security-rego-public"
+
+	// authenticatedExpression is the condition of a request with a token
+	authenticatedExpression = tokenPrefix + ".payload"
+
+	// authenticatedOp is the operation of the authenticated condition in the data tables
+	authenticatedOp = "authenticated"
+)
+
+// access is how the policy allows an operation without a boolean filter
+type access int
+
+const (
+	accessDeny access = iota
+	accessAllow
+	accessAuthenticated
+)
+
+// checkStrategy returns an error if the strategy is unknown
+func checkStrategy(strategy string) error {
+	switch strategy {
+	case "", StrategyAllow, StrategyAuthenticated, StrategyDeny:
+		return nil
+	default:
+		return fmt.Errorf("unknown strategy %v, use %v, %v or %v", strategy, StrategyAllow, StrategyAuthenticated, StrategyDeny)
+	}
+}
+
+// defaultAccess returns how the strategy allows an operation without a boolean
+// filter. Public operations are always allowed.
+func defaultAccess(swagger *openapi3.Swagger, operation *openapi3.Operation, public bool, strategy string) access {
+	switch {
+	case public:
+		return accessAllow
+	case strategy == StrategyDeny:
+		return accessDeny
+	case strategy == StrategyAuthenticated && requiresSecurity(swagger, operation):
+		return accessAuthenticated
+	default:
+		return accessAllow
+	}
+}
+
+// isPublic returns whether the operation is marked as public by the extension
+func isPublic(operation *openapi3.Operation) (bool, error) {
+	val, ok := operation.Extensions[oasSecExtRegoPublic]
+	if !ok {
+		return false, nil
+	}
+
+	var public bool
+	err := unmarshalExtension(val, &public)
+	return public, err
+}
+
+// requiresSecurity returns whether the operation or else the spec has security
+// requirements. An empty requirement makes security optional.
+func requiresSecurity(swagger *openapi3.Swagger, operation *openapi3.Operation) bool {
+	security := swagger.Security
+	if operation.Security != nil {
+		security = *operation.Security
+	}
+
+	for _, requirement := range security {
+		if len(requirement) == 0 {
+			return false
+		}
+	}
+	return len(security) > 0
+}
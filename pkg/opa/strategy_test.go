@@ -0,0 +1,76 @@
+package opa
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAuthenticatedStrategy(t *testing.T) {
+	swagger := loadTestSpec(t, `
+openapi: 3.0.0
+info: {title: strategy, version: "1"}
+security: [{oauth: [read:pets]}, {oauth: [admin]}]
+paths:
+  /pets:
+    get:
+      responses: {"200": {description: ok}}
+    post:
+      security: [{key: []}]
+      responses: {"200": {description: ok}}
+  /health:
+    get:
+      security: []
+      responses: {"200": {description: ok}}
+`)
+
+	policy, err := GenerateWithOptions(swagger, Options{PackageName: DefaultPackageName, Strategy: StrategyAuthenticated})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	expected := []string{
+		// a rule per alternative set of scopes
+		"allow if {\n  input.path = [\"pets\"]\n  input.method = \"GET\"\n  token.payload.scopes[\"read:pets\"]\n  token.payload\n}",
+		"allow if {\n  input.path = [\"pets\"]\n  input.method = \"GET\"\n  token.payload.scopes[\"admin\"]\n  token.payload\n}",
+		// a token without scopes
+		"allow if {\n  input.path = [\"pets\"]\n  input.method = \"POST\"\n  token.payload\n}",
+		// no security requirements
+		"allow if {\n  input.path = [\"health\"]\n  input.method = \"GET\"\n}",
+	}
+	for _, rule := range expected {
+		if !strings.Contains(policy, rule) {
+			t.Errorf("policy does not contain the rule\n%v\n\npolicy:\n%v", rule, policy)
+		}
+	}
+	if strings.Count(policy, "allow if {") != len(expected) {
+		t.Errorf("expected %d allow rules, policy:\n%v", len(expected), policy)
+	}
+}
+
+func TestDataAuthenticatedStrategy(t *testing.T) {
+	swagger := loadTestSpec(t, `
+openapi: 3.0.0
+info: {title: strategy, version: "1"}
+security: [{oauth: [read:pets]}, {oauth: [admin]}]
+paths:
+  /pets:
+    get:
+      responses: {"200": {description: ok}}
+`)
+
+	files, err := GenerateFiles(swagger, Options{PackageName: DefaultPackageName, Strategy: StrategyAuthenticated, Mode: ModeData})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	var data string
+	for _, file := range files {
+		if file.Name == "data.json" {
+			data = strings.Join(strings.Fields(file.Content), "")
+		}
+	}
+	expected := `"conditions":[{"op":"authenticated","operands":[]},{"op":"scopes","operands":[{"type":"value","value":["read:pets"]},{"type":"value","value":["admin"]}]}]`
+	if !strings.Contains(data, expected) {
+		t.Errorf("data does not contain %v\n\ndata:\n%v", expected, data)
+	}
+}
@@ -0,0 +1,114 @@
+package opa
+
+import (
+	"fmt"
+
+	"github.com/openapi-to-rego/pkg/rego"
+)
+
+const (
+	// TargetOPA generates a policy queried for the allow, filter, list_filter
+	// and response rules, eg. through the OPA HTTP API
+	TargetOPA = "opa"
+
+	// TargetEnvoy generates a policy for the Envoy ext_authz filter of OPA-Envoy.
+	// The "result" rule returns the response of the check.
+	TargetEnvoy = "envoy"
+)
+
+// envoyInput is the input mapping of the check requests sent by OPA-Envoy,
+// which parses the request path into segments
+var envoyInput = InputMapping{
+	InputFields: InputFields{
+		Path:       "parsed_path",
+		PathFormat: PathSegments,
+		Method:     "attributes.request.http.method",
+		Token:      "attributes.request.http.headers.authorization",
+		Object:     "parsed_body",
+	},
+	TokenSource: TokenBearer,
+}
+
+// envoyTemplate are the rules generating the response of an Envoy ext_authz check.
+// The fields of a field filter are passed to the service in a request header.
+var envoyTemplate = `
+
+# result is the response of the Envoy ext_authz check
+result {{assign}} {
+  "allowed": allow,
+  "headers": result_headers,
+  "http_status": result_http_status,
+  "body": result_body,
+}
+
+default result_headers {{assign}} {}
+{{- if .Filter}}
+
+result_headers {{assign}} {"x-field-filter": concat(",", f)}{{ifkw}} {
+  f := filter
+}
+{{- end}}
+
+default result_http_status {{assign}} 403
+
+result_http_status = 200{{ifkw}} {
+  allow
+}
+
+result_http_status = 401{{ifkw}} {
+  not allow
+  not {{input "token"}}
+}
+
+default result_body {{assign}} ""
+{{if .Decision}}
+result_body = concat("\n", decision.reasons){{ifkw}} {
+  not allow
+}
+{{else}}
+result_body = "Unauthorized"{{ifkw}} {
+  result_http_status == 401
+}
+
+result_body = "Forbidden"{{ifkw}} {
+  result_http_status == 403
+}
+{{end}}`
+
+// targetRules returns the rules added to the root policy file for the target. The
+// rules only read the rules the policy defines.
+func targetRules(options Options, policy string) (string, error) {
+	switch options.Target {
+	case "", TargetOPA:
+		return "", nil
+	case TargetEnvoy:
+		funcs, err := templateFuncs(options)
+		if err != nil {
+			return "", err
+		}
+		data := struct {
+			Decision bool
+			Filter   bool
+		}{
+			Decision: options.Decision,
+			Filter:   definesRule(policy, "filter"),
+		}
+		return executeTemplate(envoyTemplate, funcs, data)
+	default:
+		return "", fmt.Errorf("unknown target %v, use %v or %v", options.Target, TargetOPA, TargetEnvoy)
+	}
+}
+
+// definesRule returns whether the Rego policy defines a rule with the name
+func definesRule(policy string, name string) bool {
+	module, err := rego.Parse(policy)
+	if err != nil {
+		return false
+	}
+	for _, rule := range module.Rules {
+		if rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package opa
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEnvoyTarget(t *testing.T) {
+	swagger := loadTestSpec(t, testPetstore)
+
+	for _, opts := range [][]Option{
+		{},
+		{WithDecision(true)},
+		{WithRegoVersion(RegoV0)},
+		{WithMode(ModeData)},
+	} {
+		generator := NewGenerator(append([]Option{WithTarget(TargetEnvoy)}, opts...)...)
+		options := generator.Options()
+		result, err := generator.Generate(swagger)
+		if err != nil {
+			t.Fatalf("%+v: %v", options, err)
+		}
+		files := result.Files
+
+		module := checkRegoFiles(t, files)[policyFileName]
+		if module == nil {
+			t.Fatalf("%+v: no %v generated", options, policyFileName)
+		}
+		counts := map[string]int{}
+		for _, rule := range module.Rules {
+			if !rule.Default {
+				counts[rule.Name]++
+			}
+		}
+		if counts["result"] != 1 {
+			t.Errorf("%+v: result is defined %v times, want 1", options, counts["result"])
+		}
+		if counts["result_http_status"] != 2 {
+			t.Errorf("%+v: result_http_status is defined %v times, want 2", options, counts["result_http_status"])
+		}
+
+		// OPA-Envoy parses the request path into input.parsed_path
+		if content := files[0].Content; !strings.Contains(content, "input.parsed_path") || strings.Contains(content, "input.path") {
+			t.Errorf("%+v: the policy does not match input.parsed_path\n%v", options, content)
+		}
+	}
+}
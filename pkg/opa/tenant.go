@@ -0,0 +1,133 @@
+package opa
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const (
+	// OAS Extension of the document declaring where the tenant of the user and the
+	// tenant of the requests are found. Every allow rule requires them to be equal.
+	oasSecExtRegoTenant = "x-security-rego-tenant"
+
+	// OAS Extension to exempt an operation from the tenant check
+	oasSecExtRegoTenantExempt = "x-security-rego-tenant-exempt"
+)
+
+// tenantIsolation declares the claim holding the tenant of the user and the sources
+// of the tenant of the requests
+type tenantIsolation struct {
+	Claim   string   `json:"claim" required:"true" description:"Claim of the token payload holding the tenant of the user, eg. tenant_id"`
+	Sources []string `json:"sources" required:"true" description:"Path parameters given with $ or refs to the input holding the tenant of the request, the first one the operation has is compared with the claim"`
+}
+
+// loadTenant reads the tenant isolation of the document, if any. The tenant isolation
+// is nil if the extension cannot be decoded.
+func loadTenant(swagger *openapi3.Swagger) (*tenantIsolation, Errors) {
+	var errs Errors
+	val, ok := swagger.Extensions[oasSecExtRegoTenant]
+	if !ok {
+		return nil, nil
+	}
+
+	var tenant tenantIsolation
+	err := unmarshalExtension(val, &tenant)
+	if err != nil {
+		errs.add([]interface{}{oasSecExtRegoTenant}, "%v", err)
+		return nil, errs
+	}
+
+	if _, _, err := parseRef(tenant.claimRef()); err != nil || tenant.Claim == "" {
+		errs.add([]interface{}{oasSecExtRegoTenant, "claim"}, "illegal tenant claim %v", tenant.Claim)
+	}
+	if len(tenant.Sources) == 0 {
+		errs.add([]interface{}{oasSecExtRegoTenant, "sources"}, "no sources of the tenant of the requests")
+	}
+	for i, source := range tenant.Sources {
+		if strings.HasPrefix(source, pathTemplatePrefix) {
+			continue
+		}
+		if root, _, err := parseRef(source); err != nil || root != inputPrefix {
+			errs.add([]interface{}{oasSecExtRegoTenant, "sources", i}, "tenant source %v is neither a path parameter nor a ref to the %v", source, inputPrefix)
+		}
+	}
+	return &tenant, errs
+}
+
+// claimRef returns the ref of the claim holding the tenant of the user. Claims are
+// relative to the token payload unless they start with "token.".
+func (t *tenantIsolation) claimRef() string {
+	if strings.HasPrefix(t.Claim, tokenPrefix+".") {
+		return t.Claim
+	}
+	return fmt.Sprintf("%v.payload.%v", tokenPrefix, t.Claim)
+}
+
+// source returns the index of the first source the operation of the path has, ie. a
+// path parameter of the path or a ref to the input
+func (t *tenantIsolation) source(path string) (int, bool) {
+	params := map[string]bool{}
+	for _, match := range pathParamRE.FindAllStringSubmatch(path, -1) {
+		params[match[1]] = true
+	}
+
+	for i, source := range t.Sources {
+		if !strings.HasPrefix(source, pathTemplatePrefix) || params[strings.TrimLeft(source, pathTemplatePrefix)] {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// operationSource returns the index of the source the tenant of the requests of the
+// operation is read from, and false if the operation is not checked: the document
+// declares no tenant, or the operation is exempt or public. Operations without any
+// of the sources are errors, so that no operation is left unchecked by mistake.
+func (t *tenantIsolation) operationSource(o operationRef, errs *Errors) (int, bool) {
+	if t == nil {
+		return 0, false
+	}
+
+	var exempt bool
+	if val, ok := o.Operation.Extensions[oasSecExtRegoTenantExempt]; ok {
+		err := unmarshalExtension(val, &exempt)
+		if err != nil {
+			errs.add(o.extensionPointer(oasSecExtRegoTenantExempt)(), "%v", err)
+			return 0, false
+		}
+	}
+	if public, _ := isPublic(o.Operation); exempt || public {
+		return 0, false
+	}
+
+	i, ok := t.source(o.Path)
+	if !ok {
+		errs.add([]interface{}{"paths", o.Path, strings.ToLower(o.Method)}, "operation has none of the tenant sources %v, exempt it with %v", strings.Join(t.Sources, ", "), oasSecExtRegoTenantExempt)
+	}
+	return i, ok
+}
+
+// expression returns the condition of a request of the tenant of the user, reading
+// the tenant of the request from the source. Keys of the refs which are not
+// identifiers are quoted, eg. input.headers["x-tenant-id"].
+func (t *tenantIsolation) expression(source int) string {
+	value := t.Sources[source]
+	if strings.HasPrefix(value, pathTemplatePrefix) {
+		value = strings.TrimLeft(value, pathTemplatePrefix)
+	} else {
+		value = quotedRef(value)
+	}
+	return fmt.Sprintf("%v = %v", quotedRef(t.claimRef()), value)
+}
+
+// quotedRef renders a ref checked by loadTenant with the keys which are not
+// identifiers quoted
+func quotedRef(ref string) string {
+	root, path, err := parseRef(ref)
+	if err != nil {
+		return ref
+	}
+	return regoRef(root, path)
+}
@@ -0,0 +1,65 @@
+package opa
+
+import (
+	"testing"
+)
+
+func TestLoadTenant(t *testing.T) {
+	tests := []struct {
+		name   string
+		tenant string
+		errors int
+	}{
+		{name: "path parameter and input ref", tenant: `{claim: tenant_id, sources: [$tenantId, input.headers.x-tenant]}`},
+		{name: "token claim", tenant: `{claim: token.payload.org.id, sources: [$orgId]}`},
+		{name: "quoted key", tenant: `{claim: tenant_id, sources: ['input.headers["x-tenant"]']}`},
+		{name: "missing claim", tenant: `{sources: [$tenantId]}`, errors: 1},
+		{name: "missing sources", tenant: `{claim: tenant_id}`, errors: 1},
+		{name: "source outside of the input", tenant: `{claim: tenant_id, sources: [token.payload.tenant]}`, errors: 1},
+		{name: "illegal source", tenant: `{claim: tenant_id, sources: ['input.headers[x']}`, errors: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			swagger := loadTestSpec(t, `
+openapi: 3.0.0
+info: {title: tenant, version: "1"}
+x-security-rego-tenant: `+test.tenant+`
+paths: {}
+`)
+			tenant, errs := loadTenant(swagger)
+			if tenant == nil {
+				t.Fatalf("no tenant isolation loaded, errors %v", errs)
+			}
+			if len(errs) != test.errors {
+				t.Errorf("got %d error(s) %v, want %d", len(errs), errs, test.errors)
+			}
+		})
+	}
+}
+
+func TestTenantExpression(t *testing.T) {
+	tests := []struct {
+		tenant     tenantIsolation
+		expression string
+	}{
+		{
+			tenant:     tenantIsolation{Claim: "tenant_id", Sources: []string{"$tenantId"}},
+			expression: "token.payload.tenant_id = tenantId",
+		},
+		{
+			tenant:     tenantIsolation{Claim: "tenant-id", Sources: []string{"input.headers.x-tenant"}},
+			expression: `token.payload["tenant-id"] = input.headers["x-tenant"]`,
+		},
+		{
+			tenant:     tenantIsolation{Claim: "token.payload.org.id", Sources: []string{`input.headers["x-org"]`}},
+			expression: `token.payload.org.id = input.headers["x-org"]`,
+		},
+	}
+
+	for _, test := range tests {
+		if expression := test.tenant.expression(0); expression != test.expression {
+			t.Errorf("expression of %v = %v, want %v", test.tenant, expression, test.expression)
+		}
+	}
+}
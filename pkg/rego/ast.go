@@ -0,0 +1,225 @@
+// Package rego parses and checks the subset of Rego the generated policies and the
+// policies read by the import command are written in. It is not the OPA compiler:
+// it catches syntax errors, unsafe vars, rules of the same name with different kinds,
+// rules assigned with := which are defined again and calls to undefined functions,
+// so that a broken policy is not written.
+//
+// Supported are packages, imports with aliases, default, complete, partial set,
+// partial object and function rules in the v0 and v1 syntax, bodies with not and
+// some declarations, the comparison, unification and assignment operators, refs,
+// calls, arithmetic and set operators, arrays, sets, objects and comprehensions.
+//
+// Not supported and rejected as syntax errors are else, with, every and the in
+// operator, including some x in xs. Accepted although OPA rejects them are type
+// errors, calls with the wrong number of arguments, recursive rules and conflicting
+// values of complete rules.
+// The built-in functions known are the ones listed in builtins.
+package rego
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TermKind is the kind of a Rego term
+type TermKind int
+
+// Kinds of Rego terms
+const (
+	VarTerm TermKind = iota
+	StringTerm
+	NumberTerm
+	BooleanTerm
+	NullTerm
+	RefTerm
+	ArrayTerm
+	SetTerm
+	ObjectTerm
+	CallTerm
+	ArrayComprehensionTerm
+	SetComprehensionTerm
+	ObjectComprehensionTerm
+	BinaryTerm
+)
+
+// Module is a parsed Rego module
+type Module struct {
+	Package *Term
+	Imports []*Import
+	Rules   []*Rule
+}
+
+// Import is an import of a module, Alias is empty unless given with "as"
+type Import struct {
+	Path  *Term
+	Alias string
+}
+
+// Name returns the name the import is referenced by in the module, the alias or
+// else the last segment of its path
+func (i *Import) Name() string {
+	if i.Alias != "" {
+		return i.Alias
+	}
+	if i.Path.Kind != RefTerm {
+		return i.Path.Value
+	}
+	return strings.Trim(i.Path.Items[len(i.Path.Items)-1].Value, "\"")
+}
+
+// Rule is a rule or function of a Rego module. Key is set for partial set
+// and partial object rules, Args for functions. Assign is set if the value is
+// assigned with :=.
+type Rule struct {
+	Line     int
+	Default  bool
+	Name     string
+	Key      *Term
+	Args     []*Term
+	Contains bool
+	Assign   bool
+	Value    *Term
+	Body     []*Expr
+}
+
+// Kind returns whether the rule is a "complete", "set", "object" or "function" rule
+func (r *Rule) Kind() string {
+	switch {
+	case r.Args != nil:
+		return "function"
+	case r.Key != nil && (r.Contains || r.Value == nil):
+		return "set"
+	case r.Key != nil:
+		return "object"
+	default:
+		return "complete"
+	}
+}
+
+// head returns the name of the rule, followed by the key of a partial object rule
+// if it is a constant, so that rules defining different keys have different heads
+func (r *Rule) head() string {
+	if r.Kind() == "object" && len(r.Key.Vars()) == 0 {
+		return fmt.Sprintf("%v[%v]", r.Name, r.Key)
+	}
+	return r.Name
+}
+
+// Expr is an expression in a rule body. Expressions with an Op have two terms,
+// others a single term.
+type Expr struct {
+	Line    int
+	Negated bool
+	Some    []string
+	Op      string
+	Terms   []*Term
+}
+
+// String returns the expression in Rego syntax
+func (e *Expr) String() string {
+	var result string
+	switch {
+	case e.Some != nil:
+		result = "some " + strings.Join(e.Some, ", ")
+	case e.Op != "":
+		result = fmt.Sprintf("%v %v %v", e.Terms[0], e.Op, e.Terms[1])
+	default:
+		result = e.Terms[0].String()
+	}
+	if e.Negated {
+		result = "not " + result
+	}
+	return result
+}
+
+// Term is a Rego term. Value holds the literal of scalars, the name of vars
+// and calls and the operator of binary terms. Refs hold their head in Items[0]
+// followed by the path, where field accesses are string terms with Dot set.
+type Term struct {
+	Kind  TermKind
+	Value string
+	Dot   bool
+	Items []*Term
+	Pairs [][2]*Term
+	Body  []*Expr
+}
+
+// String returns the term in Rego syntax
+func (t *Term) String() string {
+	switch t.Kind {
+	case RefTerm:
+		result := t.Items[0].String()
+		for _, item := range t.Items[1:] {
+			if item.Dot {
+				result += "." + strings.Trim(item.Value, "\"")
+			} else {
+				result += "[" + item.String() + "]"
+			}
+		}
+		return result
+	case ArrayTerm:
+		return "[" + joinTerms(t.Items) + "]"
+	case SetTerm:
+		if len(t.Items) == 0 {
+			return "set()"
+		}
+		return "{" + joinTerms(t.Items) + "}"
+	case ObjectTerm:
+		pairs := make([]string, len(t.Pairs))
+		for i, pair := range t.Pairs {
+			pairs[i] = fmt.Sprintf("%v: %v", pair[0], pair[1])
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case CallTerm:
+		return t.Value + "(" + joinTerms(t.Items) + ")"
+	case ArrayComprehensionTerm:
+		return "[" + t.Items[0].String() + " | " + joinExprs(t.Body) + "]"
+	case SetComprehensionTerm:
+		return "{" + t.Items[0].String() + " | " + joinExprs(t.Body) + "}"
+	case ObjectComprehensionTerm:
+		return "{" + t.Items[0].String() + ": " + t.Items[1].String() + " | " + joinExprs(t.Body) + "}"
+	case BinaryTerm:
+		return fmt.Sprintf("%v %v %v", t.Items[0], t.Value, t.Items[1])
+	default:
+		return t.Value
+	}
+}
+
+// Vars returns the vars in the term including the head of refs
+func (t *Term) Vars() []string {
+	vars := []string{}
+	t.walk(func(term *Term) {
+		if term.Kind == VarTerm {
+			vars = append(vars, term.Value)
+		}
+	})
+	return vars
+}
+
+// walk calls f for the term and all nested terms outside of comprehension bodies
+func (t *Term) walk(f func(*Term)) {
+	f(t)
+	for _, item := range t.Items {
+		item.walk(f)
+	}
+	for _, pair := range t.Pairs {
+		pair[0].walk(f)
+		pair[1].walk(f)
+	}
+}
+
+func joinTerms(terms []*Term) string {
+	result := make([]string, len(terms))
+	for i, term := range terms {
+		result[i] = term.String()
+	}
+	return strings.Join(result, ", ")
+}
+
+func joinExprs(exprs []*Expr) string {
+	result := make([]string, len(exprs))
+	for i, expr := range exprs {
+		result[i] = expr.String()
+	}
+	return strings.Join(result, "; ")
+}
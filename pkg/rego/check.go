@@ -0,0 +1,245 @@
+package rego
+
+import (
+	"fmt"
+	"sort"
+)
+
+var (
+	// builtins are the built-in functions which may be called by a module
+	builtins = map[string]bool{
+		"count": true, "sum": true, "max": true, "min": true, "sort": true, "all": true, "any": true,
+		"sprintf": true, "format_int": true, "concat": true, "split": true, "lower": true, "upper": true,
+		"trim": true, "trim_left": true, "trim_right": true, "trim_prefix": true, "trim_suffix": true,
+		"trim_space": true, "startswith": true, "endswith": true, "contains": true, "indexof": true,
+		"substring": true, "replace": true, "regex.match": true, "glob.match": true, "to_number": true,
+		"is_string": true, "is_number": true, "is_boolean": true, "is_array": true, "is_set": true,
+		"is_object": true, "is_null": true, "type_name": true, "set": true, "intersection": true,
+		"union": true, "array.concat": true, "array.slice": true, "object.get": true, "object.keys": true,
+		"object.remove": true, "object.union": true, "json.marshal": true, "json.unmarshal": true,
+		"base64.decode": true, "base64url.decode": true, "time.now_ns": true, "walk": true,
+		"io.jwt.decode": true, "io.jwt.decode_verify": true, "io.jwt.verify_rs256": true,
+		"io.jwt.verify_hs256": true, "net.cidr_contains": true, "urlquery.decode": true,
+	}
+
+	// outputBuiltins are the built-in functions whose last argument is an output
+	outputBuiltins = map[string]bool{
+		"walk": true, "io.jwt.decode": true, "io.jwt.decode_verify": true,
+	}
+)
+
+// scope holds the vars bound in a rule body or comprehension
+type scope struct {
+	parent *scope
+	vars   map[string]bool
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{parent: parent, vars: map[string]bool{}}
+}
+
+func (s *scope) has(name string) bool {
+	for ; s != nil; s = s.parent {
+		if s.vars[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// checker collects the errors found in a module
+type checker struct {
+	globals   map[string]bool
+	functions map[string]bool
+	errors    []*Error
+}
+
+// Check checks a parsed module for the errors the OPA compiler reports for
+// the constructs used by generated policies: unsafe vars, rules of the same
+// name with different kinds, rules assigned with := defined more than once
+// and calls to undefined functions.
+func Check(module *Module) []*Error {
+	c := &checker{
+		globals:   map[string]bool{"input": true, "data": true, "_": true},
+		functions: map[string]bool{},
+	}
+
+	for _, imp := range module.Imports {
+		c.globals[imp.Name()] = true
+	}
+
+	kinds := map[string]string{}
+	heads := map[string]*Rule{}
+	for _, rule := range module.Rules {
+		c.globals[rule.Name] = true
+		if rule.Args != nil {
+			c.functions[rule.Name] = true
+		}
+	}
+
+	for _, rule := range module.Rules {
+		kind := rule.Kind()
+		if previous, ok := kinds[rule.Name]; ok && previous != kind && !rule.Default {
+			c.errorf(rule.Line, "conflicting rules %v found, %v and %v rule", rule.Name, previous, kind)
+		} else if !rule.Default {
+			kinds[rule.Name] = kind
+			if first, ok := heads[rule.head()]; ok && (first.Assign || rule.Assign) {
+				c.errorf(rule.Line, "rule %v redeclared, already defined at line %v", rule.head(), first.Line)
+			} else if !ok {
+				heads[rule.head()] = rule
+			}
+		}
+		c.checkRule(rule)
+	}
+
+	sort.SliceStable(c.errors, func(i, j int) bool { return c.errors[i].Line < c.errors[j].Line })
+	return c.errors
+}
+
+func (c *checker) errorf(line int, format string, args ...interface{}) {
+	c.errors = append(c.errors, &Error{Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) checkRule(rule *Rule) {
+	if rule.Default {
+		if vars := rule.Value.Vars(); len(vars) > 0 {
+			c.errorf(rule.Line, "default rule %v value cannot contain vars", rule.Name)
+		}
+		return
+	}
+
+	args := newScope(nil)
+	for _, arg := range rule.Args {
+		for _, name := range arg.Vars() {
+			args.vars[name] = true
+		}
+	}
+
+	body := c.checkBody(rule.Body, args, rule.Line)
+	for _, term := range []*Term{rule.Key, rule.Value} {
+		if term != nil {
+			c.checkTerm(term, body, rule.Line)
+		}
+	}
+}
+
+// checkBody checks the expressions of a body and returns the scope of the vars bound by them
+func (c *checker) checkBody(body []*Expr, outer *scope, line int) *scope {
+	local := newScope(outer)
+	for _, expr := range body {
+		if !expr.Negated {
+			bindExpr(expr, local)
+		}
+	}
+
+	for _, expr := range body {
+		for _, term := range expr.Terms {
+			c.checkTerm(term, local, expr.Line)
+		}
+	}
+	return local
+}
+
+// checkTerm reports the unsafe vars and undefined functions in a term
+func (c *checker) checkTerm(term *Term, s *scope, line int) {
+	switch term.Kind {
+	case VarTerm:
+		if !s.has(term.Value) && !c.globals[term.Value] {
+			c.errorf(line, "var %v is unsafe", term.Value)
+		}
+	case RefTerm:
+		c.checkTerm(term.Items[0], s, line)
+		for _, item := range term.Items[1:] {
+			if !item.Dot {
+				c.checkTerm(item, s, line)
+			}
+		}
+	case CallTerm:
+		if !builtins[term.Value] && !c.functions[term.Value] {
+			c.errorf(line, "undefined function %v", term.Value)
+		}
+		for _, arg := range term.Items {
+			c.checkTerm(arg, s, line)
+		}
+	case ArrayComprehensionTerm, SetComprehensionTerm, ObjectComprehensionTerm:
+		local := c.checkBody(term.Body, s, line)
+		for _, item := range term.Items {
+			c.checkTerm(item, local, line)
+		}
+	default:
+		for _, item := range term.Items {
+			c.checkTerm(item, s, line)
+		}
+		for _, pair := range term.Pairs {
+			c.checkTerm(pair[0], s, line)
+			c.checkTerm(pair[1], s, line)
+		}
+	}
+}
+
+// bindExpr adds the vars bound by an expression to the scope. Vars are bound
+// by assignments, unifications, some declarations, ref keys and the output
+// argument of built-in functions.
+func bindExpr(expr *Expr, s *scope) {
+	for _, name := range expr.Some {
+		s.vars[name] = true
+	}
+
+	switch expr.Op {
+	case ":=":
+		bindVars(expr.Terms[0], s)
+	case "=":
+		bindVars(expr.Terms[0], s)
+		bindVars(expr.Terms[1], s)
+	}
+
+	for _, term := range expr.Terms {
+		bindRefKeys(term, s)
+	}
+}
+
+// bindVars binds the vars of a term which are not the head of a ref
+func bindVars(term *Term, s *scope) {
+	switch term.Kind {
+	case VarTerm:
+		s.vars[term.Value] = true
+	case ArrayTerm, SetTerm:
+		for _, item := range term.Items {
+			bindVars(item, s)
+		}
+	case ObjectTerm:
+		for _, pair := range term.Pairs {
+			bindVars(pair[1], s)
+		}
+	}
+}
+
+// bindRefKeys binds the vars used as keys of refs and as output of built-in functions
+func bindRefKeys(term *Term, s *scope) {
+	switch term.Kind {
+	case RefTerm:
+		bindRefKeys(term.Items[0], s)
+		for _, item := range term.Items[1:] {
+			if item.Kind == VarTerm {
+				s.vars[item.Value] = true
+			}
+			bindRefKeys(item, s)
+		}
+	case CallTerm:
+		for i, arg := range term.Items {
+			if i == len(term.Items)-1 && outputBuiltins[term.Value] {
+				bindVars(arg, s)
+			}
+			bindRefKeys(arg, s)
+		}
+	case ArrayComprehensionTerm, SetComprehensionTerm, ObjectComprehensionTerm:
+	default:
+		for _, item := range term.Items {
+			bindRefKeys(item, s)
+		}
+		for _, pair := range term.Pairs {
+			bindRefKeys(pair[0], s)
+			bindRefKeys(pair[1], s)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package rego
+
+import (
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		errors []string
+	}{
+		{
+			name: "generated rules",
+			src: `package httpapi.authz
+import rego.v1
+
+default allow := false
+
+token := {"payload": payload} if { io.jwt.decode(input.token, [_, payload, _]) }
+
+allow := true if {
+  input.path = ["pets", petId]
+  input.method = "GET"
+  petId = token.payload.pets[_].petId
+}
+
+filter contains field if {
+  some field
+  masks[field]
+}
+
+masks["ssn"] := true if { not token.payload.admin }`,
+		},
+		{
+			name: "vars bound by unification and ref keys",
+			src: `package p
+allow if {
+  [a, {"b": b}] = input.pair
+  input.items[i].id = a
+  x := input.items[i]
+  x.owner = b
+}`,
+		},
+		{
+			name: "comprehension scope",
+			src: `package p
+allow if {
+  ids := {id | id := input.ids[_]}
+  count([x | x := ids[_]; x != ""]) > 0
+}`,
+		},
+		{
+			name: "function arguments",
+			src: `package p
+f(x) := y if { y := x + 1 }
+allow if { f(1) > 1 }`,
+		},
+		{
+			name: "imported names",
+			src: `package p
+import data.roles
+import data.permissions as p
+allow if { roles.admin[input.user]; p[input.user] }`,
+		},
+		{
+			name:   "import replaced by its name",
+			src:    "package p\nimport data.roles\nallow if { data.roles.admin; roles.admin; r.admin }",
+			errors: []string{"3: var r is unsafe"},
+		},
+		{
+			name:   "unsafe var",
+			src:    "package p\nallow if {\n  input.x = tenant\n  input.tenant_id = input.headers.x - tenant2\n}",
+			errors: []string{"4: var tenant2 is unsafe"},
+		},
+		{
+			name:   "var only bound in a negated expression",
+			src:    "package p\nallow if {\n  not input.xs[x]\n  x > 1\n}",
+			errors: []string{"3: var x is unsafe", "4: var x is unsafe"},
+		},
+		{
+			name:   "var of a comprehension used outside",
+			src:    "package p\nallow if {\n  ids := [id | id := input.ids[_]]\n  id = ids[0]\n}\nok if { count(ids) > 0; ids = [] }\nx := id",
+			errors: []string{"7: var id is unsafe"},
+		},
+		{
+			name:   "undefined function",
+			src:    "package p\nallow if { is_admin(input.user) }",
+			errors: []string{"2: undefined function is_admin"},
+		},
+		{
+			name:   "conflicting kinds",
+			src:    "package p\nallow := true\nallow contains x if { x := 1 }",
+			errors: []string{"3: conflicting rules allow found, complete and set rule"},
+		},
+		{
+			name:   "default with var",
+			src:    "package p\ndefault allow := x",
+			errors: []string{"2: default rule allow value cannot contain vars"},
+		},
+		{
+			name:   "redeclared assigned rule",
+			src:    "package p\nx := 1\nx := 2",
+			errors: []string{"3: rule x redeclared, already defined at line 2"},
+		},
+		{
+			name:   "assigned rule defined again",
+			src:    "package p\nallow if { input.a }\nallow := true if { input.b }",
+			errors: []string{"3: rule allow redeclared, already defined at line 2"},
+		},
+		{
+			name:   "redeclared assigned function",
+			src:    "package p\nf(x) := 1 if { x }\nf(x) := 2 if { not x }",
+			errors: []string{"3: rule f redeclared, already defined at line 2"},
+		},
+		{
+			name:   "redeclared assigned key",
+			src:    "package p\nops[\"a\"] := 1\nops[\"a\"] := 2",
+			errors: []string{"3: rule ops[\"a\"] redeclared, already defined at line 2"},
+		},
+		{
+			name: "assigned keys",
+			src:  "package p\nops[\"a\"] := 1\nops[\"b\"] := 2",
+		},
+		{
+			name: "default and assigned rule",
+			src:  "package p\ndefault allow := false\nallow := true if { input.a }",
+		},
+		{
+			name: "rule defined more than once",
+			src:  "package p\nallow if { input.a }\nallow if { input.b }\nx = 1 if { input.a }\nx = 2 if { input.b }",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			module, err := Parse(test.src)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			errs := Check(module)
+			got := []string{}
+			for _, e := range errs {
+				got = append(got, e.Error())
+			}
+			if len(got) != len(test.errors) {
+				t.Fatalf("got errors %q, want %q", got, test.errors)
+			}
+			for i := range got {
+				if got[i] != test.errors[i] {
+					t.Errorf("got error %v, want %v", got[i], test.errors[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package rego
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNewline
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+// token is a lexical token of a Rego module
+type token struct {
+	Kind  tokenKind
+	Value string
+	Line  int
+}
+
+func (t token) String() string {
+	switch t.Kind {
+	case tokenEOF:
+		return "end of file"
+	case tokenNewline:
+		return "end of line"
+	default:
+		return fmt.Sprintf("%q", t.Value)
+	}
+}
+
+// operators sorted so that the longest operator is matched first
+var operators = []string{
+	":=", "==", "!=", "<=", ">=",
+	"=", "<", ">", "+", "-", "*", "/", "%", "&", "|",
+	"{", "}", "[", "]", "(", ")", ",", ";", ":", ".",
+}
+
+// lex splits a Rego module into tokens. Comments are dropped.
+func lex(src string) ([]token, error) {
+	tokens := []token{}
+	line := 1
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			tokens = append(tokens, token{Kind: tokenNewline, Value: "\n", Line: line})
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			j := i + 1
+			for ; j < len(src) && src[j] != '"'; j++ {
+				if src[j] == '\\' {
+					j++
+				}
+				if j < len(src) && src[j] == '\n' {
+					return nil, &Error{Line: line, Message: "unterminated string"}
+				}
+			}
+			if j >= len(src) {
+				return nil, &Error{Line: line, Message: "unterminated string"}
+			}
+			tokens = append(tokens, token{Kind: tokenString, Value: src[i : j+1], Line: line})
+			i = j + 1
+		case c == '`':
+			j := strings.IndexByte(src[i+1:], '`')
+			if j < 0 {
+				return nil, &Error{Line: line, Message: "unterminated raw string"}
+			}
+			value := src[i : i+j+2]
+			tokens = append(tokens, token{Kind: tokenString, Value: value, Line: line})
+			line += strings.Count(value, "\n")
+			i += j + 2
+		case isDigit(c):
+			j := i
+			for j < len(src) && (isDigit(src[j]) || src[j] == '.' || src[j] == 'e' || src[j] == 'E') {
+				j++
+			}
+			tokens = append(tokens, token{Kind: tokenNumber, Value: src[i:j], Line: line})
+			i = j
+		case isIdentStart(rune(c)):
+			j := i
+			for j < len(src) && (isIdentStart(rune(src[j])) || isDigit(src[j])) {
+				j++
+			}
+			tokens = append(tokens, token{Kind: tokenIdent, Value: src[i:j], Line: line})
+			i = j
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{Kind: tokenOperator, Value: op, Line: line})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, &Error{Line: line, Message: fmt.Sprintf("illegal character %q", c)}
+			}
+		}
+	}
+
+	tokens = append(tokens, token{Kind: tokenEOF, Line: line})
+	return tokens, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r < unicode.MaxASCII && unicode.IsLetter(r)
+}
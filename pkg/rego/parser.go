@@ -0,0 +1,580 @@
+package rego
+
+import (
+	"fmt"
+)
+
+var (
+	// keywords cannot be used as vars or rule names
+	keywords = map[string]bool{
+		"package": true, "import": true, "default": true, "not": true, "some": true, "with": true,
+		"as": true, "else": true, "if": true, "in": true, "every": true,
+	}
+
+	// exprOperators are the operators of expressions in rule bodies
+	exprOperators = map[string]bool{
+		":=": true, "=": true, "==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+	}
+
+	// termOperators are the arithmetic and set operators of terms
+	termOperators = map[string]bool{
+		"+": true, "-": true, "*": true, "/": true, "%": true, "&": true,
+	}
+)
+
+// Error is an error in a Rego module
+type Error struct {
+	Line    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %v", e.Line, e.Message)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse parses a Rego module. Both the v0 and the v1 syntax are supported.
+func Parse(src string) (*Module, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	return p.parseModule()
+}
+
+// ParseTerm parses a single term, eg. the operand of an expression
+func ParseTerm(src string) (*Term, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	p.skipNewlines()
+	term, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	p.skipNewlines()
+	if p.peek().Kind != tokenEOF {
+		return nil, p.unexpected("end of term")
+	}
+	return term, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.Kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) is(value string) bool {
+	t := p.peek()
+	return (t.Kind == tokenOperator || t.Kind == tokenIdent) && t.Value == value
+}
+
+func (p *parser) skipNewlines() {
+	for p.peek().Kind == tokenNewline {
+		p.next()
+	}
+}
+
+func (p *parser) expect(value string) error {
+	if !p.is(value) {
+		return p.unexpected(fmt.Sprintf("%q", value))
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) unexpected(expected string) error {
+	return unexpectedToken(p.peek(), expected)
+}
+
+func unexpectedToken(t token, expected string) error {
+	return &Error{Line: t.Line, Message: fmt.Sprintf("unexpected %v, expected %v", t, expected)}
+}
+
+func (p *parser) endOfLine() error {
+	switch p.peek().Kind {
+	case tokenNewline:
+		p.next()
+		return nil
+	case tokenEOF:
+		return nil
+	default:
+		return p.unexpected("end of line")
+	}
+}
+
+func (p *parser) parseModule() (*Module, error) {
+	module := &Module{}
+
+	p.skipNewlines()
+	if err := p.expect("package"); err != nil {
+		return nil, err
+	}
+	pkg, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	module.Package = pkg
+	if err := p.endOfLine(); err != nil {
+		return nil, err
+	}
+
+	for {
+		p.skipNewlines()
+		if p.peek().Kind == tokenEOF {
+			return module, nil
+		}
+
+		if p.is("import") {
+			p.next()
+			path, err := p.parseTerm()
+			if err != nil {
+				return nil, err
+			}
+			imp := &Import{Path: path}
+			if p.is("as") {
+				p.next()
+				alias := p.next()
+				if alias.Kind != tokenIdent {
+					return nil, unexpectedToken(alias, "import alias")
+				}
+				imp.Alias = alias.Value
+			}
+			module.Imports = append(module.Imports, imp)
+			if err := p.endOfLine(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		rule, err := p.parseRule()
+		if err != nil {
+			return nil, err
+		}
+		module.Rules = append(module.Rules, rule)
+	}
+}
+
+func (p *parser) parseRule() (*Rule, error) {
+	rule := &Rule{Line: p.peek().Line}
+
+	if p.is("default") {
+		p.next()
+		rule.Default = true
+	}
+
+	name := p.next()
+	if name.Kind != tokenIdent || keywords[name.Value] {
+		return nil, unexpectedToken(name, "rule name")
+	}
+	rule.Name = name.Value
+
+	var err error
+	switch {
+	case p.is("["):
+		p.next()
+		rule.Key, err = p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+	case p.is("("):
+		p.next()
+		rule.Args, err = p.parseTerms(")")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.is("contains") {
+		p.next()
+		rule.Contains = true
+		rule.Key, err = p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.is("=") || p.is(":=") {
+		rule.Assign = p.is(":=")
+		p.next()
+		rule.Value, err = p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rule.Default {
+		if rule.Value == nil {
+			return nil, &Error{Line: rule.Line, Message: fmt.Sprintf("default rule %v must have a value", rule.Name)}
+		}
+		return rule, p.endOfLine()
+	}
+
+	hasIf := p.is("if")
+	if hasIf {
+		p.next()
+	}
+
+	switch {
+	case p.is("{"):
+		p.next()
+		rule.Body, err = p.parseBody("}")
+		if err != nil {
+			return nil, err
+		}
+	case hasIf:
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		rule.Body = []*Expr{expr}
+	case rule.Value == nil && rule.Key == nil:
+		return nil, p.unexpected("rule body")
+	}
+
+	return rule, p.endOfLine()
+}
+
+// parseBody parses the expressions after an opening brace or bracket until the closing one
+func (p *parser) parseBody(closing string) ([]*Expr, error) {
+	body := []*Expr{}
+	for {
+		for p.peek().Kind == tokenNewline || p.is(";") {
+			p.next()
+		}
+		if p.is(closing) {
+			p.next()
+			return body, nil
+		}
+
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, expr)
+
+		if p.peek().Kind != tokenNewline && !p.is(";") && !p.is(closing) {
+			return nil, p.unexpected("end of expression")
+		}
+	}
+}
+
+func (p *parser) parseExpr() (*Expr, error) {
+	expr := &Expr{Line: p.peek().Line}
+
+	if p.is("not") {
+		p.next()
+		expr.Negated = true
+	}
+
+	if p.is("some") {
+		p.next()
+		for {
+			t := p.next()
+			if t.Kind != tokenIdent || keywords[t.Value] {
+				return nil, unexpectedToken(t, "var")
+			}
+			expr.Some = append(expr.Some, t.Value)
+			if !p.is(",") {
+				return expr, nil
+			}
+			p.next()
+		}
+	}
+
+	term, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	expr.Terms = []*Term{term}
+
+	t := p.peek()
+	if t.Kind == tokenOperator && exprOperators[t.Value] {
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		expr.Op = t.Value
+		expr.Terms = append(expr.Terms, right)
+	}
+	return expr, nil
+}
+
+// parseTerms parses terms separated by commas until the closing operator
+func (p *parser) parseTerms(closing string) ([]*Term, error) {
+	terms := []*Term{}
+	for {
+		p.skipNewlines()
+		if p.is(closing) {
+			p.next()
+			return terms, nil
+		}
+
+		term, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+
+		p.skipNewlines()
+		if p.is(",") {
+			p.next()
+		} else if !p.is(closing) {
+			return nil, p.unexpected(fmt.Sprintf("%q or %q", ",", closing))
+		}
+	}
+}
+
+func (p *parser) parseTerm() (*Term, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if t.Kind != tokenOperator || !termOperators[t.Value] {
+			return left, nil
+		}
+		p.next()
+		p.skipNewlines()
+
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		left = &Term{Kind: BinaryTerm, Value: t.Value, Items: []*Term{left, right}}
+	}
+}
+
+func (p *parser) parseOperand() (*Term, error) {
+	t := p.next()
+
+	switch {
+	case t.Kind == tokenString:
+		return &Term{Kind: StringTerm, Value: t.Value}, nil
+	case t.Kind == tokenNumber:
+		return &Term{Kind: NumberTerm, Value: t.Value}, nil
+	case t.Kind == tokenOperator && t.Value == "-" && p.peek().Kind == tokenNumber:
+		return &Term{Kind: NumberTerm, Value: "-" + p.next().Value}, nil
+	case t.Kind == tokenIdent && (t.Value == "true" || t.Value == "false"):
+		return &Term{Kind: BooleanTerm, Value: t.Value}, nil
+	case t.Kind == tokenIdent && t.Value == "null":
+		return &Term{Kind: NullTerm, Value: t.Value}, nil
+	case t.Kind == tokenIdent && !keywords[t.Value]:
+		return p.parseRef(&Term{Kind: VarTerm, Value: t.Value})
+	case t.Kind == tokenOperator && t.Value == "(":
+		term, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		return term, p.expect(")")
+	case t.Kind == tokenOperator && t.Value == "[":
+		return p.parseArray()
+	case t.Kind == tokenOperator && t.Value == "{":
+		return p.parseObjectOrSet()
+	}
+
+	return nil, unexpectedToken(t, "term")
+}
+
+// parseRef parses the path and arguments following the head of a ref or call
+func (p *parser) parseRef(head *Term) (*Term, error) {
+	term := head
+	for {
+		switch {
+		case p.is("."):
+			p.next()
+			field := p.next()
+			if field.Kind != tokenIdent {
+				return nil, unexpectedToken(field, "field name")
+			}
+			term = appendRef(term, &Term{Kind: StringTerm, Value: fmt.Sprintf("%q", field.Value), Dot: true})
+		case p.is("["):
+			p.next()
+			p.skipNewlines()
+			key, err := p.parseTerm()
+			if err != nil {
+				return nil, err
+			}
+			p.skipNewlines()
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			term = appendRef(term, key)
+		case p.is("(") && (term.Kind == VarTerm || term.Kind == RefTerm && isDotted(term)):
+			p.next()
+			args, err := p.parseTerms(")")
+			if err != nil {
+				return nil, err
+			}
+			term = &Term{Kind: CallTerm, Value: term.String(), Items: args}
+		default:
+			return term, nil
+		}
+	}
+}
+
+func appendRef(term *Term, item *Term) *Term {
+	if term.Kind != RefTerm {
+		term = &Term{Kind: RefTerm, Items: []*Term{term}}
+	}
+	term.Items = append(term.Items, item)
+	return term
+}
+
+// isDotted returns whether the ref only consists of field accesses, eg. io.jwt.decode
+func isDotted(ref *Term) bool {
+	if ref.Items[0].Kind != VarTerm {
+		return false
+	}
+	for _, item := range ref.Items[1:] {
+		if !item.Dot {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *parser) parseArray() (*Term, error) {
+	p.skipNewlines()
+	if p.is("]") {
+		p.next()
+		return &Term{Kind: ArrayTerm, Items: []*Term{}}, nil
+	}
+
+	first, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipNewlines()
+	if p.is("|") {
+		p.next()
+		body, err := p.parseBody("]")
+		if err != nil {
+			return nil, err
+		}
+		return &Term{Kind: ArrayComprehensionTerm, Items: []*Term{first}, Body: body}, nil
+	}
+
+	items := []*Term{first}
+	if p.is(",") {
+		p.next()
+		rest, err := p.parseTerms("]")
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, rest...)
+	} else if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	return &Term{Kind: ArrayTerm, Items: items}, nil
+}
+
+func (p *parser) parseObjectOrSet() (*Term, error) {
+	p.skipNewlines()
+	if p.is("}") {
+		p.next()
+		return &Term{Kind: ObjectTerm, Pairs: [][2]*Term{}}, nil
+	}
+
+	first, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	p.skipNewlines()
+
+	if p.is("|") {
+		p.next()
+		body, err := p.parseBody("}")
+		if err != nil {
+			return nil, err
+		}
+		return &Term{Kind: SetComprehensionTerm, Items: []*Term{first}, Body: body}, nil
+	}
+
+	if !p.is(":") {
+		items := []*Term{first}
+		if p.is(",") {
+			p.next()
+			rest, err := p.parseTerms("}")
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, rest...)
+		} else if err := p.expect("}"); err != nil {
+			return nil, err
+		}
+		return &Term{Kind: SetTerm, Items: items}, nil
+	}
+
+	p.next()
+	p.skipNewlines()
+	value, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	p.skipNewlines()
+
+	if p.is("|") {
+		p.next()
+		body, err := p.parseBody("}")
+		if err != nil {
+			return nil, err
+		}
+		return &Term{Kind: ObjectComprehensionTerm, Items: []*Term{first, value}, Body: body}, nil
+	}
+
+	object := &Term{Kind: ObjectTerm, Pairs: [][2]*Term{{first, value}}}
+	for {
+		p.skipNewlines()
+		if p.is("}") {
+			p.next()
+			return object, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		p.skipNewlines()
+		if p.is("}") {
+			p.next()
+			return object, nil
+		}
+
+		key, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		p.skipNewlines()
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		p.skipNewlines()
+		value, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		object.Pairs = append(object.Pairs, [2]*Term{key, value})
+	}
+}
@@ -0,0 +1,263 @@
+package rego
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{
+			name: "v0 rules",
+			src: `package httpapi.authz
+
+default allow = false
+
+allow {
+  input.path = ["pets", petId]
+  input.method = "GET"
+  token.payload.scopes["read:pets"]
+}
+
+token = {"payload": payload} { io.jwt.decode(input.token, [_, payload, _]) }
+
+filter[x] { x := input.fields[_] }
+
+masks["pets"] = ["ssn"] { true }`,
+		},
+		{
+			name: "v1 rules",
+			src: `package httpapi.authz
+import rego.v1
+
+default allow := false
+
+allow := true if {
+  request_path = ["pets", petId]
+  not input.blocked
+}
+
+filter contains x if { some x; x = input.fields[_] }
+
+request_path = ["/"] if { trim(split(input.path, "?")[0], "/") == "" }
+
+allowed if input.method == "GET"`,
+		},
+		{
+			name: "functions and comprehensions",
+			src: `package p
+
+permitted(roles, operation) if {
+  count([r | r := roles[_]; r != ""]) > 0
+  ids := {id | id := operation.ids[_]}
+  names := {k: v | v := operation.names[k]}
+  x := (1 + 2) * -3 % 2
+  y := ids & {"a", "b"}
+  z := set()
+}`,
+		},
+		{
+			name: "raw strings and comments",
+			src:  "package p\n# comment\nre := `^a\"b`\n",
+		},
+		{
+			name: "import alias",
+			src:  "package p\nimport data.roles as r\nallow if r.admin\n",
+		},
+		{
+			name: "missing package",
+			src:  "allow := true",
+			err:  `1: unexpected "allow", expected "package"`,
+		},
+		{
+			name: "unterminated string",
+			src:  "package p\nx := \"a\n",
+			err:  "2: unterminated string",
+		},
+		{
+			name: "illegal character",
+			src:  "package p\nx := 1 ^ 2\n",
+			err:  `2: illegal character '^'`,
+		},
+		{
+			name: "default without value",
+			src:  "package p\ndefault allow\n",
+			err:  "2: default rule allow must have a value",
+		},
+		{
+			name: "keyword as rule name",
+			src:  "package p\nnot := 1\n",
+			err:  `2: unexpected "not", expected rule name`,
+		},
+		{
+			name: "unclosed body",
+			src:  "package p\nallow if {\n  input.x\n",
+			err:  `4: unexpected end of file, expected term`,
+		},
+		{
+			name: "two expressions on a line",
+			src:  "package p\nallow if { input.x input.y }\n",
+			err:  `2: unexpected "input", expected end of expression`,
+		},
+		{
+			name: "unsupported else",
+			src:  "package p\nx := 1 if { input.a } else := 2\n",
+			err:  `2: unexpected "else", expected end of line`,
+		},
+		{
+			name: "unsupported in",
+			src:  "package p\nallow if { some x in input.xs }\n",
+			err:  `2: unexpected "in", expected end of expression`,
+		},
+		{
+			name: "unsupported with",
+			src:  "package p\nallow if { data.q with input as {} }\n",
+			err:  `2: unexpected "with", expected end of expression`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(test.src)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case test.err != "" && err == nil:
+				t.Errorf("expected error %v", test.err)
+			case test.err != "" && err.Error() != test.err:
+				t.Errorf("got error %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	module, err := Parse(`package p
+import rego.v1
+
+default allow := false
+
+allow := true if { input.x }
+
+filter contains x if { x := input.xs[_] }
+
+masks[k] = v { v := input.m[k] }
+
+f(x) := y if { y := x + 1 }
+`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	expected := []struct {
+		name    string
+		kind    string
+		line    int
+		dflt    bool
+		exprs   int
+		printed string
+	}{
+		{name: "allow", kind: "complete", line: 4, dflt: true},
+		{name: "allow", kind: "complete", line: 6, exprs: 1, printed: "input.x"},
+		{name: "filter", kind: "set", line: 8, exprs: 1, printed: "x := input.xs[_]"},
+		{name: "masks", kind: "object", line: 10, exprs: 1, printed: "v := input.m[k]"},
+		{name: "f", kind: "function", line: 12, exprs: 1, printed: "y := x + 1"},
+	}
+	if len(module.Rules) != len(expected) {
+		t.Fatalf("got %d rules, want %d", len(module.Rules), len(expected))
+	}
+	if module.Package.String() != "p" || len(module.Imports) != 1 || module.Imports[0].Path.String() != "rego.v1" {
+		t.Errorf("got package %v and imports %v", module.Package, module.Imports)
+	}
+
+	for i, e := range expected {
+		rule := module.Rules[i]
+		if rule.Name != e.name || rule.Kind() != e.kind || rule.Line != e.line || rule.Default != e.dflt || len(rule.Body) != e.exprs {
+			t.Errorf("rule %d: got %v %v at line %d, default %v with %d expression(s)", i, rule.Kind(), rule.Name, rule.Line, rule.Default, len(rule.Body))
+			continue
+		}
+		if e.exprs > 0 && rule.Body[0].String() != e.printed {
+			t.Errorf("rule %d: got expression %v, want %v", i, rule.Body[0], e.printed)
+		}
+	}
+}
+
+func TestTermString(t *testing.T) {
+	tests := []string{
+		`token.payload.scopes["read:pets"]`,
+		`input.path = ["pets", petId]`,
+		`not input.blocked`,
+		`x := {"a": 1, "b": [true, null]}`,
+		`ids := {id | id := input.ids[_]}`,
+		`names := {k: v | v := input.names[k]}`,
+		`n := count([r | r := input.roles[_]])`,
+		`io.jwt.decode(input.token, [_, payload, _])`,
+		`s := set()`,
+		`x := a + b`,
+		`some x, y`,
+	}
+
+	for _, test := range tests {
+		module, err := Parse("package p\nallow if { " + test + " }\n")
+		if err != nil {
+			t.Errorf("Parse(%v): %v", test, err)
+			continue
+		}
+		if printed := module.Rules[0].Body[0].String(); printed != test {
+			t.Errorf("got %v, want %v", printed, test)
+		}
+	}
+}
+
+func TestParseTerm(t *testing.T) {
+	tests := []struct {
+		src   string
+		valid bool
+	}{
+		{src: `"hidden"`, valid: true},
+		{src: `null`, valid: true},
+		{src: `18`, valid: true},
+		{src: `-1`, valid: true},
+		{src: `["a", "b"]`, valid: true},
+		{src: `token.payload.pets[_].petId`, valid: true},
+		{src: `data.resources.pets[petId].owner`, valid: true},
+		{src: `hello world`},
+		{src: `"unterminated`},
+		{src: `input.`},
+		{src: `not input.blocked`},
+		{src: `a := b`},
+		{src: ``},
+	}
+
+	for _, test := range tests {
+		term, err := ParseTerm(test.src)
+		if test.valid && err != nil {
+			t.Errorf("ParseTerm(%v): %v", test.src, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("ParseTerm(%v) = %v, want an error", test.src, term)
+		}
+	}
+}
+
+func TestLexLines(t *testing.T) {
+	tokens, err := lex("package p\n\nx := `a\nb`\ny := 1 # comment\n")
+	if err != nil {
+		t.Fatalf("lex: %v", err)
+	}
+
+	lines := []string{}
+	for _, token := range tokens {
+		if token.Kind != tokenNewline && token.Kind != tokenEOF {
+			lines = append(lines, strings.Replace(token.Value, "\n", `\n`, -1)+"@"+string(rune('0'+token.Line)))
+		}
+	}
+	expected := "package@1 p@1 x@3 :=@3 `a\\nb`@3 y@5 :=@5 1@5"
+	if got := strings.Join(lines, " "); got != expected {
+		t.Errorf("got tokens %v, want %v", got, expected)
+	}
+}
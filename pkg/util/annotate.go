@@ -0,0 +1,111 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// AddExtension adds a key with the value to the object the pointer references in
+// an OpenAPI spec in JSON or YAML, given by its file path and content. YAML specs
+// keep their layout and comments, the key is added at the end of the block mapping.
+// JSON specs are written indented with sorted keys.
+func AddExtension(filePath string, data []byte, pointer string, key string, value interface{}) ([]byte, error) {
+	if strings.ToLower(filepath.Ext(filePath)) == ".json" {
+		return addJSONKey(data, pointer, key, value)
+	}
+	return addYAMLKey(data, pointer, key, value)
+}
+
+// addYAMLKey inserts the key with the value at the end of the block mapping at the pointer
+func addYAMLKey(data []byte, pointer string, key string, value interface{}) ([]byte, error) {
+	src := string(data)
+	lines := map[string]int{"": 1}
+	indexYAML(src, lines)
+
+	pointer = strings.TrimPrefix(pointer, "#")
+	line, ok := lines[pointer]
+	if !ok || pointer == "" {
+		return nil, fmt.Errorf("%v is not a block mapping in the spec", pointer)
+	}
+	if _, ok := lines[pointer+"/"+escapePointerToken(key)]; ok {
+		return nil, fmt.Errorf("%v already has the key %v", pointer, key)
+	}
+
+	text := strings.Split(src, "\n")
+	indent := indentOf(text[line-1])
+
+	// the block ends before the first line which is not indented deeper
+	childIndent, end := -1, line
+	for i := line; i < len(text); i++ {
+		content := strings.TrimSpace(text[i])
+		if content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		if indentOf(text[i]) <= indent {
+			break
+		}
+		if childIndent < 0 {
+			childIndent = indentOf(text[i])
+		}
+		end = i + 1
+	}
+	if childIndent < 0 {
+		return nil, fmt.Errorf("%v is not a block mapping in the spec", pointer)
+	}
+
+	out, err := yaml.Marshal(map[string]interface{}{key: value})
+	if err != nil {
+		return nil, err
+	}
+	block := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	for i := range block {
+		block[i] = strings.Repeat(" ", childIndent) + block[i]
+	}
+
+	result := append([]string{}, text[:end]...)
+	result = append(result, block...)
+	result = append(result, text[end:]...)
+	return []byte(strings.Join(result, "\n")), nil
+}
+
+// addJSONKey adds the key with the value to the object at the pointer
+func addJSONKey(data []byte, pointer string, key string, value interface{}) ([]byte, error) {
+	var doc interface{}
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	target := doc
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "#/"), "/") {
+		object, ok := target.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v is not an object in the spec", pointer)
+		}
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		target = object[token]
+	}
+
+	object, ok := target.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v is not an object in the spec", pointer)
+	}
+	if _, ok := object[key]; ok {
+		return nil, fmt.Errorf("%v already has the key %v", pointer, key)
+	}
+	object[key] = value
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
@@ -4,13 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"path/filepath"
 	"strings"
 
 	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/ghodss/yaml"
 )
 
-// LoadSwagger initializes an OpenAPI object given an OpenAPI 3 file
+// LoadSwagger initializes an OpenAPI object given an OpenAPI 3 file. References to
+// components in other YAML files are resolved relative to the file.
 func LoadSwagger(filePath string) (*openapi3.Swagger, error) {
 	data, err := ioutil.ReadFile(filePath)
 	if err != nil {
@@ -22,7 +25,9 @@ func LoadSwagger(filePath string) (*openapi3.Swagger, error) {
 	ext = strings.ToLower(ext)
 	switch ext {
 	case ".yaml", ".yml":
-		swagger, err = openapi3.NewSwaggerLoader().LoadSwaggerFromData(data)
+		loader := openapi3.NewSwaggerLoader()
+		loader.IsExternalRefsAllowed = true
+		swagger, err = loader.LoadSwaggerFromDataWithPath(data, &url.URL{Path: filePath})
 	case ".json":
 		swagger = &openapi3.Swagger{}
 		err = json.Unmarshal(data, swagger)
@@ -35,3 +40,22 @@ func LoadSwagger(filePath string) (*openapi3.Swagger, error) {
 	}
 	return swagger, nil
 }
+
+// LoadConfig decodes a JSON or YAML config file into v. YAML is decoded with the
+// JSON field names of v.
+func LoadConfig(filePath string, v interface{}) error {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	ext := strings.ToLower(filepath.Ext(filePath))
+	switch ext {
+	case ".yaml", ".yml":
+		return yaml.Unmarshal(data, v)
+	case ".json":
+		return json.Unmarshal(data, v)
+	default:
+		return fmt.Errorf("%s is not a supported extension, use .yaml, .yml or .json", ext)
+	}
+}
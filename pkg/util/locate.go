@@ -0,0 +1,279 @@
+package util
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Locator resolves JSON pointers into an OpenAPI spec to the lines of its source file
+type Locator struct {
+	lines map[string]int
+}
+
+// NewLocator reads the OpenAPI spec file and indexes the line of each value in it
+func NewLocator(filePath string) (*Locator, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Locator{lines: map[string]int{"": 1}}
+	if strings.ToLower(filepath.Ext(filePath)) == ".json" {
+		s := &jsonScanner{src: data, line: 1, lines: l.lines}
+		s.value("")
+	} else {
+		indexYAML(string(data), l.lines)
+	}
+	return l, nil
+}
+
+// Line returns the line of the value the pointer references. If the value is not
+// indexed, eg. as it is part of a flow collection, the line of the closest parent
+// is returned.
+func (l *Locator) Line(pointer string) int {
+	pointer = strings.TrimPrefix(pointer, "#")
+	for {
+		if line, ok := l.lines[pointer]; ok {
+			return line
+		}
+		i := strings.LastIndex(pointer, "/")
+		if i < 0 {
+			return 0
+		}
+		pointer = pointer[:i]
+	}
+}
+
+// escapePointerToken escapes a token of a JSON pointer
+func escapePointerToken(token string) string {
+	token = strings.Replace(token, "~", "~0", -1)
+	return strings.Replace(token, "/", "~1", -1)
+}
+
+// yamlCollection is a block mapping or sequence of a YAML document being indexed
+type yamlCollection struct {
+	indent   int
+	pointer  string
+	sequence bool
+	index    int
+}
+
+// indexYAML indexes the lines of the keys and sequence items of the block
+// collections in a YAML document
+func indexYAML(src string, lines map[string]int) {
+	stack := []*yamlCollection{{indent: 0, pointer: ""}}
+
+	// pending is the pointer of a key or item whose value starts on the next lines
+	pending, pendingIndent := "", -1
+	scalarIndent := -1
+
+	for n, text := range strings.Split(src, "\n") {
+		content := strings.TrimLeft(text, " ")
+		indent := len(text) - len(content)
+		if strings.TrimSpace(content) == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		if scalarIndent >= 0 {
+			if indent > scalarIndent {
+				continue
+			}
+			scalarIndent = -1
+		}
+		if strings.HasPrefix(content, "---") || strings.HasPrefix(content, "%") {
+			continue
+		}
+
+		item := content == "-" || strings.HasPrefix(content, "- ")
+		if pending != "" && (indent > pendingIndent || indent == pendingIndent && item) {
+			stack = append(stack, &yamlCollection{indent: indent, pointer: pending, sequence: item})
+		}
+		pending = ""
+
+		for len(stack) > 1 {
+			top := stack[len(stack)-1]
+			if top.indent > indent || top.indent == indent && top.sequence && !item {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			break
+		}
+
+		top := stack[len(stack)-1]
+		line := n + 1
+		for item {
+			if !top.sequence || top.indent != indent {
+				break
+			}
+			pointer := top.pointer + "/" + strconv.Itoa(top.index)
+			top.index++
+			lines[pointer] = line
+
+			rest := strings.TrimLeft(content[1:], " ")
+			if rest == "" {
+				pending, pendingIndent = pointer, indent
+				break
+			}
+			indent += len(content) - len(rest)
+			content = rest
+
+			item = content == "-" || strings.HasPrefix(content, "- ")
+			if item {
+				top = &yamlCollection{indent: indent, pointer: pointer, sequence: true}
+				stack = append(stack, top)
+			} else if _, _, ok := yamlKey(content); ok {
+				top = &yamlCollection{indent: indent, pointer: pointer}
+				stack = append(stack, top)
+			}
+		}
+		if item {
+			continue
+		}
+
+		key, value, ok := yamlKey(content)
+		if !ok || top.sequence {
+			continue
+		}
+		pointer := top.pointer + "/" + escapePointerToken(key)
+		lines[pointer] = line
+
+		switch {
+		case value == "":
+			pending, pendingIndent = pointer, indent
+		case strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">"):
+			scalarIndent = indent
+		}
+	}
+}
+
+// yamlKey splits a line of a block mapping into the key and the value
+func yamlKey(content string) (string, string, bool) {
+	var key string
+	rest := content
+
+	if strings.HasPrefix(content, "\"") || strings.HasPrefix(content, "'") {
+		end := strings.IndexByte(content[1:], content[0])
+		if end < 0 {
+			return "", "", false
+		}
+		key = content[1 : end+1]
+		rest = content[end+2:]
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", false
+		}
+		rest = rest[1:]
+	} else {
+		i := strings.Index(content, ": ")
+		if i < 0 {
+			if !strings.HasSuffix(content, ":") {
+				return "", "", false
+			}
+			i = len(content) - 1
+		}
+		key = content[:i]
+		rest = content[i+1:]
+		if key == "" || strings.ContainsAny(key[:1], "[{\"'") {
+			return "", "", false
+		}
+	}
+
+	value := strings.TrimSpace(rest)
+	if strings.HasPrefix(value, "#") {
+		value = ""
+	}
+	return key, value, true
+}
+
+// jsonScanner indexes the lines of the values in a JSON document
+type jsonScanner struct {
+	src   []byte
+	pos   int
+	line  int
+	lines map[string]int
+}
+
+func (s *jsonScanner) skipSpace() {
+	for s.pos < len(s.src) {
+		switch s.src[s.pos] {
+		case '\n':
+			s.line++
+		case ' ', '\t', '\r':
+		default:
+			return
+		}
+		s.pos++
+	}
+}
+
+// value scans the value at the pointer
+func (s *jsonScanner) value(pointer string) {
+	s.skipSpace()
+	if s.pos >= len(s.src) {
+		return
+	}
+	s.lines[pointer] = s.line
+
+	switch s.src[s.pos] {
+	case '{':
+		s.pos++
+		for {
+			s.skipSpace()
+			if s.pos >= len(s.src) || s.src[s.pos] == '}' {
+				s.pos++
+				return
+			}
+			if s.src[s.pos] == ',' {
+				s.pos++
+				continue
+			}
+			key, err := strconv.Unquote(s.str())
+			if err != nil {
+				return
+			}
+			s.skipSpace()
+			if s.pos < len(s.src) && s.src[s.pos] == ':' {
+				s.pos++
+			}
+			s.value(pointer + "/" + escapePointerToken(key))
+		}
+	case '[':
+		s.pos++
+		for i := 0; ; {
+			s.skipSpace()
+			if s.pos >= len(s.src) || s.src[s.pos] == ']' {
+				s.pos++
+				return
+			}
+			if s.src[s.pos] == ',' {
+				s.pos++
+				continue
+			}
+			s.value(pointer + "/" + strconv.Itoa(i))
+			i++
+		}
+	case '"':
+		s.str()
+	default:
+		for s.pos < len(s.src) && !strings.ContainsRune(",}] \t\r\n", rune(s.src[s.pos])) {
+			s.pos++
+		}
+	}
+}
+
+// str scans a string and returns it quoted
+func (s *jsonScanner) str() string {
+	start := s.pos
+	s.pos++
+	for s.pos < len(s.src) && s.src[s.pos] != '"' {
+		if s.src[s.pos] == '\\' {
+			s.pos++
+		}
+		s.pos++
+	}
+	s.pos++
+	if s.pos > len(s.src) {
+		return ""
+	}
+	return string(s.src[start:s.pos])
+}
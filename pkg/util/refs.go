@@ -0,0 +1,91 @@
+package util
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// RefFiles returns the local files an OpenAPI spec file references with $ref,
+// directly or through other referenced files. References to remote documents
+// are ignored.
+func RefFiles(filePath string) ([]string, error) {
+	visited := map[string]bool{filepath.Clean(filePath): true}
+	err := collectRefFiles(filePath, visited)
+
+	files := []string{}
+	for file := range visited {
+		if file != filepath.Clean(filePath) {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files, err
+}
+
+// collectRefFiles adds the files the file references to the visited files
+func collectRefFiles(filePath string, visited map[string]bool) error {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	// JSON is YAML as well
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	err = json.Unmarshal(data, &doc)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs(doc) {
+		location, err := url.Parse(ref)
+		if err != nil || location.Scheme != "" && location.Scheme != "file" || location.Path == "" {
+			continue
+		}
+
+		file := filepath.FromSlash(location.Path)
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(filePath), file)
+		}
+		file = filepath.Clean(file)
+		if visited[file] {
+			continue
+		}
+		visited[file] = true
+
+		err = collectRefFiles(file, visited)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refs returns the values of the $ref keys in the document which are not local to it
+func refs(doc interface{}) []string {
+	found := []string{}
+	switch val := doc.(type) {
+	case map[string]interface{}:
+		for key, item := range val {
+			if ref, ok := item.(string); ok && key == "$ref" && !strings.HasPrefix(ref, "#") {
+				found = append(found, ref)
+				continue
+			}
+			found = append(found, refs(item)...)
+		}
+	case []interface{}:
+		for _, item := range val {
+			found = append(found, refs(item)...)
+		}
+	}
+	return found
+}
@@ -0,0 +1,93 @@
+package util
+
+import (
+	"os"
+	"time"
+)
+
+// Watcher polls files for changes of their size or modification time. Polling
+// works the same on every platform and file system, eg. mounted volumes.
+type Watcher struct {
+	// Interval is the time between polling the files
+	Interval time.Duration
+
+	// Debounce is the time the files must stay unchanged after a change before
+	// the change is reported, so that editors saving several files or writing
+	// a file in several steps trigger a single change
+	Debounce time.Duration
+}
+
+// fileState is the state of a file compared between polls
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// Watch polls the files returned by files and calls onChange once they changed.
+// The files are polled on every tick, files may return a different list after
+// a change, eg. to watch added references.
+// Watch returns when stop is closed.
+func (w *Watcher) Watch(files func() []string, onChange func(), stop <-chan struct{}) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	states := w.states(files())
+	var changed time.Time
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			current := w.states(files())
+			if !sameStates(states, current) {
+				states = current
+				changed = now
+				continue
+			}
+
+			if !changed.IsZero() && now.Sub(changed) >= w.Debounce {
+				changed = time.Time{}
+				onChange()
+
+				// files added by the change are watched from now on, changes of the
+				// other files while handling the change are still reported
+				current = w.states(files())
+				for file := range current {
+					if state, ok := states[file]; ok {
+						current[file] = state
+					}
+				}
+				states = current
+			}
+		}
+	}
+}
+
+// states returns the current state of the files
+func (w *Watcher) states(files []string) map[string]fileState {
+	states := map[string]fileState{}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			states[file] = fileState{}
+			continue
+		}
+		states[file] = fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+	}
+	return states
+}
+
+func sameStates(a map[string]fileState, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, state := range a {
+		other, ok := b[file]
+		if !ok || other != state {
+			return false
+		}
+	}
+	return true
+}